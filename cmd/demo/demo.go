@@ -415,8 +415,14 @@ func (s *state) handleSync(w http.ResponseWriter, req *syncRequest) {
 		remote := val.(treeinfo)
 
 		lockAll(local, remote)
-		local.site.Merge(remote.site)
+		err := local.site.Merge(remote.site)
 		unlockAll(local, remote)
+		if err != nil {
+			log.Printf("Error merging %q into %q: %v", remoteID, req.LocalID, err)
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, "merge error: %v", err)
+			return
+		}
 
 		log.Printf("%s: merge     = %s", req.LocalID, remoteID)
 		// Write debug info.
@@ -0,0 +1,554 @@
+package crdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+)
+
+// Binary encoding of a CausalTree.
+//
+// The encoding starts with a magic string and a version byte, followed by the tree's
+// scalar fields, the sitemap, the compaction horizon, the yarns and finally the weave:
+//
+//   "CTREE" version
+//   site-id timestamp cursor
+//   #sites site-id...
+//   #sites-in-horizon timestamp...
+//   #atoms-in-yarn-0 atom... #atoms-in-yarn-1 atom... ...
+//   #atoms-in-weave (site index)...
+//
+// Integers are written as varints. Within a yarn, an atom's site and index are implicit
+// from its position, so only its timestamp, cause and value are written. The weave is
+// written as references to atoms within yarns, since it contains the same atoms, except for
+// the ones removed by Compact.
+
+const (
+	binaryMagic   = "CTREE"
+	binaryVersion = 1
+)
+
+// Tags to identify atom values in binary encoding. Tags must never be reused.
+// Atoms removed by Compact have no value, and are tagged with compactedTag.
+const (
+	compactedTag byte = iota
+	insertCharTag
+	deleteTag
+	insertStrTag
+	insertAddTag
+	insertCounterTag
+	insertListTag
+	insertElemTag
+	insertMapTag
+	insertKeyTag
+	insertRegisterTag
+	setTag
+	insertSetTag
+	insertMemberTag
+	markStartTag
+	markEndTag
+	moveFromTag
+	moveToTag
+	tombstoneTag
+)
+
+// Tags to identify the type of a scalar value in Set, InsertMember and MarkStart atoms. Tags must never be reused.
+const (
+	stringScalarTag byte = iota
+	intScalarTag
+	falseScalarTag
+	trueScalarTag
+	floatScalarTag
+	nilScalarTag
+)
+
+// Errors returned when decoding a CausalTree.
+var (
+	ErrInvalidEncoding    = errors.New("invalid causal tree encoding")
+	ErrUnsupportedVersion = errors.New("unsupported causal tree encoding version")
+)
+
+// +----------+
+// | Encoding |
+// +----------+
+
+type binaryEncoder struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *binaryEncoder) uvarint(x uint64) {
+	n := binary.PutUvarint(e.scratch[:], x)
+	e.buf.Write(e.scratch[:n])
+}
+
+func (e *binaryEncoder) varint(x int64) {
+	n := binary.PutVarint(e.scratch[:], x)
+	e.buf.Write(e.scratch[:n])
+}
+
+func (e *binaryEncoder) uuid(id uuid.UUID) {
+	e.buf.Write(id[:])
+}
+
+func (e *binaryEncoder) atomID(id AtomID) {
+	e.uvarint(uint64(id.Site))
+	e.uvarint(uint64(id.Index))
+	e.uvarint(uint64(id.Timestamp))
+}
+
+func (e *binaryEncoder) scalar(x interface{}) error {
+	switch x := x.(type) {
+	case string:
+		e.buf.WriteByte(stringScalarTag)
+		e.uvarint(uint64(len(x)))
+		e.buf.WriteString(x)
+	case int64:
+		e.buf.WriteByte(intScalarTag)
+		e.varint(x)
+	case bool:
+		if x {
+			e.buf.WriteByte(trueScalarTag)
+		} else {
+			e.buf.WriteByte(falseScalarTag)
+		}
+	case float64:
+		e.buf.WriteByte(floatScalarTag)
+		e.uvarint(math.Float64bits(x))
+	case nil:
+		e.buf.WriteByte(nilScalarTag)
+	default:
+		return fmt.Errorf("binary encoding: %w: %T (%v)", ErrInvalidScalar, x, x)
+	}
+	return nil
+}
+
+func (e *binaryEncoder) value(value AtomValue) error {
+	switch v := value.(type) {
+	case nil:
+		e.buf.WriteByte(compactedTag)
+	case InsertChar:
+		e.buf.WriteByte(insertCharTag)
+		e.varint(int64(v.Char))
+	case Delete:
+		e.buf.WriteByte(deleteTag)
+	case InsertStr:
+		e.buf.WriteByte(insertStrTag)
+	case InsertAdd:
+		e.buf.WriteByte(insertAddTag)
+		e.varint(int64(v.Value))
+	case InsertCounter:
+		e.buf.WriteByte(insertCounterTag)
+	case InsertList:
+		e.buf.WriteByte(insertListTag)
+	case InsertElem:
+		e.buf.WriteByte(insertElemTag)
+	case InsertMap:
+		e.buf.WriteByte(insertMapTag)
+	case InsertKey:
+		e.buf.WriteByte(insertKeyTag)
+		e.uvarint(uint64(len(v.Key)))
+		e.buf.WriteString(v.Key)
+	case InsertRegister:
+		e.buf.WriteByte(insertRegisterTag)
+	case Set:
+		e.buf.WriteByte(setTag)
+		return e.scalar(v.Value)
+	case InsertSet:
+		e.buf.WriteByte(insertSetTag)
+	case InsertMember:
+		e.buf.WriteByte(insertMemberTag)
+		return e.scalar(v.Value)
+	case MarkStart:
+		e.buf.WriteByte(markStartTag)
+		e.uvarint(uint64(len(v.Name)))
+		e.buf.WriteString(v.Name)
+		return e.scalar(v.Value)
+	case MarkEnd:
+		e.buf.WriteByte(markEndTag)
+	case MoveFrom:
+		e.buf.WriteByte(moveFromTag)
+	case MoveTo:
+		e.buf.WriteByte(moveToTag)
+	case Tombstone:
+		e.buf.WriteByte(tombstoneTag)
+	default:
+		return fmt.Errorf("binary encoding: unknown atom value %T (%v)", value, value)
+	}
+	return nil
+}
+
+// MarshalBinary encodes the tree into a compact binary form.
+//
+// Time complexity: O(atoms + sites)
+func (t *CausalTree) MarshalBinary() ([]byte, error) {
+	e := new(binaryEncoder)
+	e.buf.WriteString(binaryMagic)
+	e.buf.WriteByte(binaryVersion)
+	e.uuid(t.SiteID)
+	e.uvarint(uint64(t.Timestamp))
+	e.atomID(t.Cursor)
+	e.uvarint(uint64(len(t.Sitemap)))
+	for _, siteID := range t.Sitemap {
+		e.uuid(siteID)
+	}
+	e.uvarint(uint64(len(t.horizon)))
+	for _, ts := range t.horizon {
+		e.uvarint(uint64(ts))
+	}
+	if len(t.Yarns) != len(t.Sitemap) {
+		return nil, fmt.Errorf("binary encoding: %d yarns for %d sites", len(t.Yarns), len(t.Sitemap))
+	}
+	for _, yarn := range t.Yarns {
+		e.uvarint(uint64(len(yarn)))
+		for _, atom := range yarn {
+			e.uvarint(uint64(atom.ID.Timestamp))
+			e.atomID(atom.Cause)
+			if err := e.value(atom.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	e.uvarint(uint64(t.weave.len()))
+	t.weave.walk(0, func(atom Atom) bool {
+		e.uvarint(uint64(atom.ID.Site))
+		e.uvarint(uint64(atom.ID.Index))
+		return true
+	})
+	return e.buf.Bytes(), nil
+}
+
+// +----------+
+// | Decoding |
+// +----------+
+
+// Decoder that keeps the first error found, so that callers may check it only once.
+type binaryDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *binaryDecoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrInvalidEncoding, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *binaryDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) == 0 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *binaryDecoder) bytes(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if len(d.data) < n {
+		d.fail("unexpected end of data")
+		return make([]byte, n)
+	}
+	bs := d.data[:n]
+	d.data = d.data[n:]
+	return bs
+}
+
+func (d *binaryDecoder) uvarint(max uint64) uint64 {
+	if d.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail("malformed uvarint")
+		return 0
+	}
+	if x > max {
+		d.fail("value %d exceeds maximum %d", x, max)
+		return 0
+	}
+	d.data = d.data[n:]
+	return x
+}
+
+func (d *binaryDecoder) varint(min, max int64) int64 {
+	if d.err != nil {
+		return 0
+	}
+	x, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail("malformed varint")
+		return 0
+	}
+	if x < min || x > max {
+		d.fail("value %d out of range [%d, %d]", x, min, max)
+		return 0
+	}
+	d.data = d.data[n:]
+	return x
+}
+
+// Reads a length prefix, checking that there is at least one byte for each element.
+func (d *binaryDecoder) length() int {
+	n := d.uvarint(uint64(len(d.data)))
+	return int(n)
+}
+
+func (d *binaryDecoder) uuid() uuid.UUID {
+	var id uuid.UUID
+	copy(id[:], d.bytes(len(id)))
+	return id
+}
+
+func (d *binaryDecoder) atomID() AtomID {
+	return AtomID{
+		Site:      uint16(d.uvarint(math.MaxUint16)),
+		Index:     uint32(d.uvarint(math.MaxUint32)),
+		Timestamp: uint32(d.uvarint(math.MaxUint32)),
+	}
+}
+
+func (d *binaryDecoder) scalar() interface{} {
+	tag := d.byte()
+	if d.err != nil {
+		return nil
+	}
+	switch tag {
+	case stringScalarTag:
+		return string(d.bytes(d.length()))
+	case intScalarTag:
+		return d.varint(math.MinInt64, math.MaxInt64)
+	case falseScalarTag:
+		return false
+	case trueScalarTag:
+		return true
+	case floatScalarTag:
+		x := math.Float64frombits(d.uvarint(math.MaxUint64))
+		if _, err := scalarValue(x); err != nil {
+			d.fail("invalid float %v", x)
+		}
+		return x
+	case nilScalarTag:
+		return nil
+	}
+	d.fail("unknown scalar tag %d", tag)
+	return nil
+}
+
+func (d *binaryDecoder) nonNilScalar() interface{} {
+	x := d.scalar()
+	if x == nil {
+		d.fail("missing scalar value")
+	}
+	return x
+}
+
+func (d *binaryDecoder) value() AtomValue {
+	tag := d.byte()
+	if d.err != nil {
+		return nil
+	}
+	switch tag {
+	case compactedTag:
+		return nil
+	case insertCharTag:
+		return InsertChar{rune(d.varint(math.MinInt32, math.MaxInt32))}
+	case deleteTag:
+		return Delete{}
+	case insertStrTag:
+		return InsertStr{}
+	case insertAddTag:
+		return InsertAdd{int32(d.varint(math.MinInt32, math.MaxInt32))}
+	case insertCounterTag:
+		return InsertCounter{}
+	case insertListTag:
+		return InsertList{}
+	case insertElemTag:
+		return InsertElem{}
+	case insertMapTag:
+		return InsertMap{}
+	case insertKeyTag:
+		return InsertKey{string(d.bytes(d.length()))}
+	case insertRegisterTag:
+		return InsertRegister{}
+	case setTag:
+		return Set{d.nonNilScalar()}
+	case insertSetTag:
+		return InsertSet{}
+	case insertMemberTag:
+		return InsertMember{d.nonNilScalar()}
+	case markStartTag:
+		name := string(d.bytes(d.length()))
+		return MarkStart{name, d.scalar()}
+	case markEndTag:
+		return MarkEnd{}
+	case moveFromTag:
+		return MoveFrom{}
+	case moveToTag:
+		return MoveTo{}
+	case tombstoneTag:
+		return Tombstone{}
+	}
+	d.fail("unknown atom value tag %d", tag)
+	return nil
+}
+
+// UnmarshalBinary decodes a tree encoded with MarshalBinary, replacing the current contents.
+//
+// Time complexity: O(atoms + sites)
+func (t *CausalTree) UnmarshalBinary(data []byte) error {
+	d := &binaryDecoder{data: data}
+	if magic := d.bytes(len(binaryMagic)); d.err != nil || string(magic) != binaryMagic {
+		return fmt.Errorf("%w: missing header", ErrInvalidEncoding)
+	}
+	version := d.byte()
+	if d.err != nil {
+		return d.err
+	}
+	if version != binaryVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	siteID := d.uuid()
+	timestamp := uint32(d.uvarint(math.MaxUint32))
+	cursor := d.atomID()
+	// Read sitemap.
+	numSites := d.length()
+	sitemap := make([]uuid.UUID, numSites)
+	for i := range sitemap {
+		sitemap[i] = d.uuid()
+	}
+	// Read horizon.
+	var horizon Weft
+	if n := d.length(); n > 0 {
+		horizon = make(Weft, n)
+		for i := range horizon {
+			horizon[i] = uint32(d.uvarint(math.MaxUint32))
+		}
+	}
+	// Read yarns.
+	yarns := make([][]Atom, numSites)
+	var numAtoms int
+	for i := range yarns {
+		yarns[i] = make([]Atom, d.length())
+		for j := range yarns[i] {
+			yarns[i][j] = Atom{
+				ID: AtomID{
+					Site:      uint16(i),
+					Index:     uint32(j),
+					Timestamp: uint32(d.uvarint(math.MaxUint32)),
+				},
+				Cause: d.atomID(),
+				Value: d.value(),
+			}
+			if !isCompacted(yarns[i][j]) {
+				numAtoms++
+			}
+		}
+	}
+	// Read weave as references to yarns.
+	if n := d.length(); d.err == nil && n != numAtoms {
+		d.fail("weave has %d atoms, yarns have %d", n, numAtoms)
+	}
+	weave := make([]Atom, 0, numAtoms)
+	seen := make(map[AtomID]bool, numAtoms)
+	for i := 0; i < numAtoms && d.err == nil; i++ {
+		site, index := d.uvarint(math.MaxUint16), d.uvarint(math.MaxUint32)
+		if d.err != nil {
+			break
+		}
+		if site >= uint64(numSites) || index >= uint64(len(yarns[site])) {
+			d.fail("weave references unknown atom S%d[%d]", site, index)
+			break
+		}
+		atom := yarns[site][index]
+		if isCompacted(atom) {
+			d.fail("weave references compacted atom %v", atom.ID)
+			break
+		}
+		if seen[atom.ID] {
+			d.fail("weave references atom %v twice", atom.ID)
+			break
+		}
+		seen[atom.ID] = true
+		weave = append(weave, atom)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidEncoding, len(d.data))
+	}
+	if err := checkDecodedTree(sitemap, yarns, siteID, cursor, horizon); err != nil {
+		return err
+	}
+	return t.replaceDecoded(CausalTree{
+		Weave:     weave,
+		weave:     newWeave(weave),
+		horizon:   horizon,
+		Cursor:    cursor,
+		Yarns:     yarns,
+		Sitemap:   sitemap,
+		SiteID:    siteID,
+		Timestamp: timestamp,
+	})
+}
+
+// Replaces the tree with a decoded one, after checking that it's consistent. Cursor handles are
+// moved to the same atoms in the decoded tree.
+func (t *CausalTree) replaceDecoded(decoded CausalTree) error {
+	if err := decoded.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+	}
+	t.rebindCursors(&decoded)
+	*t = decoded
+	return nil
+}
+
+// Checks references between decoded fields, so that a decoded tree won't panic when used.
+func checkDecodedTree(sitemap []uuid.UUID, yarns [][]Atom, siteID uuid.UUID, cursor AtomID, horizon Weft) error {
+	for i := 1; i < len(sitemap); i++ {
+		if bytes.Compare(sitemap[i-1][:], sitemap[i][:]) >= 0 {
+			return fmt.Errorf("%w: sitemap is not sorted", ErrInvalidEncoding)
+		}
+	}
+	if i := siteIndex(sitemap, siteID); i == len(sitemap) || sitemap[i] != siteID {
+		return fmt.Errorf("%w: site %v is not in sitemap", ErrInvalidEncoding, siteID)
+	}
+	exists := func(id AtomID) bool {
+		if id.Timestamp == 0 {
+			return id == AtomID{}
+		}
+		return int(id.Site) < len(yarns) && int(id.Index) < len(yarns[id.Site]) &&
+			yarns[id.Site][id.Index].ID == id && !isCompacted(yarns[id.Site][id.Index])
+	}
+	if horizon != nil && len(horizon) != len(sitemap) {
+		return fmt.Errorf("%w: horizon has %d sites, sitemap has %d", ErrInvalidEncoding, len(horizon), len(sitemap))
+	}
+	for i, yarn := range yarns {
+		for _, atom := range yarn {
+			if isCompacted(atom) {
+				if horizon == nil || atom.ID.Timestamp > horizon[i] {
+					return fmt.Errorf("%w: atom %v is compacted after horizon", ErrInvalidEncoding, atom.ID)
+				}
+				continue
+			}
+			if !exists(atom.Cause) {
+				return fmt.Errorf("%w: atom %v has unknown cause %v", ErrInvalidEncoding, atom.ID, atom.Cause)
+			}
+		}
+	}
+	if !exists(cursor) {
+		return fmt.Errorf("%w: cursor %v is not in tree", ErrInvalidEncoding, cursor)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package crdt_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000003-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := setupTestView(t)
+	t0, t1 := trees[0], trees[1]
+	if err := t0.InsertCounter(); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.InsertAdd(-12); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.InsertStr(); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.InsertChar('ç'); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := t0.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got := new(crdt.CausalTree)
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if diff := cmp.Diff(t0, got, treeOpts); diff != "" {
+		t.Errorf("round-trip (-want, +got):\n%s", diff)
+	}
+
+	// Decoded tree should behave exactly as the original one.
+	t2, _ := t1.Fork()
+	if err := t2.InsertCharAt('z', 0); err != nil {
+		t.Fatal(err)
+	}
+	t0.Merge(t2)
+	got.Merge(t2)
+	if diff := cmp.Diff(t0, got, treeOpts); diff != "" {
+		t.Errorf("merge (-want, +got):\n%s", diff)
+	}
+	if s := got.ToString(); s != "*ç$0xzabdyefg" {
+		t.Errorf("got.ToString() = %q, want %q", s, "*ç$0xzabdyefg")
+	}
+}
+
+func TestUnmarshalBinaryError(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := setupTestView(t)
+	data, err := trees[0].MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	badVersion := append([]byte{}, data...)
+	badVersion[5] = 99
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, crdt.ErrInvalidEncoding},
+		{"bad magic", []byte("CTREX\x01"), crdt.ErrInvalidEncoding},
+		{"bad version", badVersion, crdt.ErrUnsupportedVersion},
+		{"truncated", data[:len(data)-1], crdt.ErrInvalidEncoding},
+		{"trailing", append(append([]byte{}, data...), 0), crdt.ErrInvalidEncoding},
+	}
+	for _, test := range tests {
+		tree := new(crdt.CausalTree)
+		if err := tree.UnmarshalBinary(test.data); !errors.Is(err, test.want) {
+			t.Errorf("%s: got err %v, want %v", test.name, err, test.want)
+		}
+	}
+}
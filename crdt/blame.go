@@ -0,0 +1,42 @@
+package crdt
+
+import (
+	"github.com/google/uuid"
+)
+
+// +-------+
+// | Blame |
+// +-------+
+
+// BlameRun is a run of consecutive visible chars created by the same site.
+type BlameRun struct {
+	// Site that created the chars.
+	Site uuid.UUID
+	Text string
+	// Lamport timestamp of each char in Text, in order.
+	Timestamps []uint32
+}
+
+// Blame returns the authorship of the tree's contents, split in runs of chars created by the same
+// site. The concatenation of the runs' text is equal to ToString.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) Blame() []BlameRun {
+	var runs []BlameRun
+	var text []Atom
+	var timestamps []uint32
+	var site uint16
+	for _, atom := range t.filterDeleted() {
+		if len(text) > 0 && atom.ID.Site != site {
+			runs = append(runs, BlameRun{t.Sitemap[site], atomsToString(text), timestamps})
+			text, timestamps = nil, nil
+		}
+		text = append(text, atom)
+		timestamps = append(timestamps, atom.ID.Timestamp)
+		site = atom.ID.Site
+	}
+	if len(text) > 0 {
+		runs = append(runs, BlameRun{t.Sitemap[site], atomsToString(text), timestamps})
+	}
+	return runs
+}
@@ -0,0 +1,45 @@
+package crdt_test
+
+import (
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBlame(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if got := t0.Blame(); len(got) != 0 {
+		t.Errorf("Blame() of empty tree = %v, want empty", got)
+	}
+	if err := t0.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// t1 appends "de", and t0 deletes "a" and inserts "x" after "b".
+	if err := t1.InsertString("de", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.DeleteCharAt(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.InsertCharAt('x', 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if got := t0.ToString(); got != "bxcde" {
+		t.Fatalf("ToString() = %q, want %q", got, "bxcde")
+	}
+	want := []crdt.BlameRun{
+		{t0.SiteID, "bxc", []uint32{3, 7, 4}},
+		{t1.SiteID, "de", []uint32{6, 7}},
+	}
+	if diff := cmp.Diff(want, t0.Blame()); diff != "" {
+		t.Errorf("Blame (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,122 @@
+package crdt
+
+// +---------+
+// | Changes |
+// +---------+
+
+// Change is a visible atom that was inserted or deleted between two versions of a tree.
+type Change struct {
+	// Whether the atom is visible in the newer version, and not in the older one, or vice versa.
+	Inserted bool
+	Atom     Atom
+	// Char representing the atom in ToString.
+	Char rune
+	// Position of the atom in the newer version, if inserted, or in the older one, if deleted.
+	Pos int
+}
+
+// Changes returns the atoms that became visible or stopped being visible from one version to the
+// other, in weave order. That is, it reports the difference between the ToString of their views,
+// using atom identity instead of comparing text. Moved atoms are not reported, but positions
+// follow the moves in each version.
+//
+// The wefts may be concurrent, in which case Changes reports the atoms seen only by each of them.
+//
+// Time complexity: O(atoms + sites)
+func (t *CausalTree) Changes(from, to Weft) ([]Change, error) {
+	fromLimits, err := t.checkWeft(from)
+	if err != nil {
+		return nil, err
+	}
+	toLimits, err := t.checkWeft(to)
+	if err != nil {
+		return nil, err
+	}
+	if t.isBehindHorizon(from) || t.isBehindHorizon(to) {
+		return nil, ErrWeftCompacted
+	}
+	atoms := t.weave.weaveAtoms()
+	older := &versionWalk{limits: fromLimits}
+	newer := &versionWalk{limits: toLimits}
+	inOlder := make([]bool, len(atoms))
+	inNewer := make([]bool, len(atoms))
+	for i := range atoms {
+		inOlder[i], inNewer[i] = older.isVisible(atoms, i), newer.isVisible(atoms, i)
+	}
+	olderPositions, newerPositions := older.positions(atoms), newer.positions(atoms)
+	var changes []Change
+	for i, atom := range atoms {
+		switch {
+		case inNewer[i] && !inOlder[i]:
+			changes = append(changes, Change{true, atom.Atom, atomChar(atom.Atom), newerPositions[i]})
+		case inOlder[i] && !inNewer[i]:
+			changes = append(changes, Change{false, atom.Atom, atomChar(atom.Atom), olderPositions[i]})
+		}
+	}
+	return changes, nil
+}
+
+// State of a walk over the weave, computing the visibility of atoms in a past version.
+type versionWalk struct {
+	limits indexWeft
+	// Visibility state in this version of the atoms walked so far.
+	states map[AtomID]weaveAtom
+}
+
+// Returns whether the i-th atom of the weave is visible in this version. It must be called for
+// each atom in order.
+//
+// Time complexity: O(number of deletes)
+func (v *versionWalk) isVisible(atoms []weaveAtom, i int) bool {
+	atom := weaveAtom{Atom: atoms[i].Atom, isDeleted: isTombstone(atoms[i].Atom)}
+	if !v.limits.isInView(atom.ID) {
+		return false
+	}
+	if cause, ok := v.states[atom.Cause]; ok {
+		atom.isBuried = cause.buries(atom.Atom)
+	}
+	// Delete atoms have the highest priority, so they are the first children.
+	for j := i + 1; j < len(atoms) && atoms[j].Cause == atom.ID; j++ {
+		if _, ok := atoms[j].Value.(Delete); !ok {
+			break
+		}
+		if v.limits.isInView(atoms[j].ID) {
+			atom.isDeleted = true
+			break
+		}
+	}
+	if v.states == nil {
+		v.states = make(map[AtomID]weaveAtom)
+	}
+	v.states[atom.ID] = atom
+	return atom.isVisible()
+}
+
+// Returns the position of each atom in this version, after all of them were walked, taking the
+// moves in this version into account. See flatOrder.
+//
+// Time complexity: O(atoms)
+func (v *versionWalk) positions(atoms []weaveAtom) []int {
+	var version []weaveAtom
+	var indices []int
+	for i, atom := range atoms {
+		if state, ok := v.states[atom.ID]; ok {
+			version = append(version, state)
+			indices = append(indices, i)
+		}
+	}
+	_, _, versionPositions := flatOrder(version)
+	positions := make([]int, len(atoms))
+	for k, i := range indices {
+		positions[i] = versionPositions[k]
+	}
+	return positions
+}
+
+// Returns the char representing an atom in ToString.
+func atomChar(atom Atom) rune {
+	for _, ch := range atomsToString([]Atom{atom}) {
+		return ch
+	}
+	return 0
+}
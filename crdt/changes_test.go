@@ -0,0 +1,197 @@
+package crdt_test
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Change without its atom, for comparison.
+type change struct {
+	Inserted bool
+	Char     rune
+	Pos      int
+}
+
+func summarizeChanges(changes []crdt.Change) []change {
+	var cs []change
+	for _, c := range changes {
+		cs = append(cs, change{c.Inserted, c.Char, c.Pos})
+	}
+	return cs
+}
+
+func TestChanges(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	w0 := tree.Now()
+	if err := tree.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	w1 := tree.Now()
+	if err := tree.DeleteCharAt(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.InsertCharAt('x', 1); err != nil {
+		t.Fatal(err)
+	}
+	w2 := tree.Now()
+	tests := []struct {
+		from, to crdt.Weft
+		want     []change
+	}{
+		{w0, w1, []change{{true, 'a', 0}, {true, 'b', 1}, {true, 'c', 2}}},
+		{w1, w2, []change{{false, 'b', 1}, {true, 'x', 2}}},
+		{w2, w1, []change{{true, 'b', 1}, {false, 'x', 2}}},
+		{w1, w1, nil},
+	}
+	for i, test := range tests {
+		changes, err := tree.Changes(test.from, test.to)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if diff := cmp.Diff(test.want, summarizeChanges(changes)); diff != "" {
+			t.Errorf("#%d: Changes(%v, %v) (-want, +got):\n%s", i, test.from, test.to, diff)
+		}
+	}
+}
+
+func TestChangesDeletedContainer(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertCounter(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.InsertStr(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.InsertString("hi", 0); err != nil {
+		t.Fatal(err)
+	}
+	w1 := tree.Now()
+	// Chars within a deleted container are deleted too.
+	if err := tree.DeleteCharAt(0); err != nil {
+		t.Fatal(err)
+	}
+	w2 := tree.Now()
+	changes, err := tree.Changes(w1, w2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []change{{false, '*', 0}, {false, 'h', 1}, {false, 'i', 2}}
+	if diff := cmp.Diff(want, summarizeChanges(changes)); diff != "" {
+		t.Errorf("Changes (-want, +got):\n%s", diff)
+	}
+}
+
+func TestChangesConcurrent(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if err := t0.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.DeleteCharAt(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.InsertCharAt('y', 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	// Wefts where each site saw only its own edit.
+	var i0, i1 int
+	for i, site := range t0.Sitemap {
+		switch site {
+		case t0.SiteID:
+			i0 = i
+		case t1.SiteID:
+			i1 = i
+		}
+	}
+	w0 := t0.Now()
+	w0[i1] = 0
+	w1 := t0.Now()
+	yarn := t0.Yarns[i0]
+	w1[i0] = yarn[len(yarn)-2].ID.Timestamp
+	changes, err := t0.Changes(w0, w1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []change{{true, 'a', 0}, {true, 'y', 3}}
+	if diff := cmp.Diff(want, summarizeChanges(changes)); diff != "" {
+		t.Errorf("Changes (-want, +got):\n%s", diff)
+	}
+}
+
+func TestChangesErrors(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Changes(crdt.Weft{}, tree.Now()); !errors.Is(err, crdt.ErrWeftInvalidLength) {
+		t.Errorf("got err %v, want %v", err, crdt.ErrWeftInvalidLength)
+	}
+}
+
+// Removes the runes at the given positions from s.
+func removePositions(s string, positions map[int]bool) string {
+	var rs []rune
+	for i, r := range []rune(s) {
+		if !positions[i] {
+			rs = append(rs, r)
+		}
+	}
+	return string(rs)
+}
+
+// Changes agree with the contents of views at each weft.
+func TestChangesMatchViews(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	tree := crdt.NewCausalTree()
+	var wefts []crdt.Weft
+	for i := 0; i < 50; i++ {
+		n := len([]rune(tree.ToString()))
+		if n > 0 && rnd.Intn(3) == 0 {
+			if err := tree.DeleteCharAt(rnd.Intn(n)); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			if err := tree.InsertCharAt(rune('a'+rnd.Intn(26)), rnd.Intn(n+1)-1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		wefts = append(wefts, tree.Now())
+	}
+	for i := 0; i < 20; i++ {
+		from, to := wefts[rnd.Intn(len(wefts))], wefts[rnd.Intn(len(wefts))]
+		changes, err := tree.Changes(from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deleted, inserted := make(map[int]bool), make(map[int]bool)
+		for _, c := range changes {
+			if c.Inserted {
+				inserted[c.Pos] = true
+			} else {
+				deleted[c.Pos] = true
+			}
+		}
+		v1, err := tree.ViewAt(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2, err := tree.ViewAt(to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s1, s2 := v1.ToString(), v2.ToString()
+		if got1, got2 := removePositions(s1, deleted), removePositions(s2, inserted); got1 != got2 {
+			t.Errorf("%q without deleted (%q) != %q without inserted (%q)", s1, got1, s2, got2)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package crdt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// +------------+
+// | Compaction |
+// +------------+
+
+// Errors returned when operating with compacted trees.
+var (
+	ErrWeftCompacted  = errors.New("weft is behind the stable weft of a compaction")
+	ErrMergeCompacted = errors.New("can't merge with a tree that hasn't seen the stable weft of a compaction")
+)
+
+// Compact removes deleted atoms created before the stable weft, along with their Delete atoms.
+//
+// The stable weft must have been seen by all sites, including this one, and this tree must have
+// merged all atoms created by a site before it has seen the stable weft, e.g., the meet of the
+// wefts from every site. This guarantees that no other site will create an atom referencing a
+// removed atom, or delete an atom in a removed subtree.
+//
+// An atom is removed only if all of its descendants are also removed, so that the relative order
+// of remaining atoms is the same as in trees that weren't compacted. Removed atoms are kept in
+// yarns as holes, without a cause or value, to preserve the index of other atoms. Deleted chars
+// and list elements that still have descendants, e.g., a deleted char in the middle of a text, are
+// collapsed into Tombstone atoms instead, and their Delete atoms are removed.
+//
+// A compacted tree refuses to merge with trees that haven't seen all atoms up to the stable weft,
+// and vice-versa.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) Compact(stable Weft) error {
+	limits, err := t.checkWeft(stable)
+	if err != nil {
+		return err
+	}
+	t.compact(limits)
+	return nil
+}
+
+// Removes deleted atoms within the limits, which must have been checked with checkWeft.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) compact(limits indexWeft) {
+	atoms := t.weave.weaveAtoms()
+	var positions atomPositions
+	for i, atom := range atoms {
+		positions.set(atom.ID, i)
+	}
+	// Find subtrees whose atoms are all invisible and within the stable weft.
+	// Descendants are always to the right of an atom, so they are visited first.
+	isDead := make([]bool, len(atoms))
+	hasLiveDescendant := make([]bool, len(atoms))
+	for i := len(atoms) - 1; i >= 0; i-- {
+		atom := atoms[i]
+		isDead[i] = limits.isInView(atom.ID) && !atom.isLive() && !hasLiveDescendant[i]
+		if j := positions.get(atom.Cause); j >= 0 && !isDead[i] {
+			hasLiveDescendant[j] = true
+		}
+	}
+	// Find deleted chars and list elements with remaining descendants, whose Delete atoms are all
+	// within the stable weft. Delete atoms have the highest priority, so they are the first children.
+	isCollapsed := make([]bool, len(atoms))
+	for i, atom := range atoms {
+		switch atom.Value.(type) {
+		case InsertChar, InsertElem:
+		default:
+			continue
+		}
+		if isDead[i] || !atom.isDeleted || atom.isBuried || !limits.isInView(atom.ID) {
+			continue
+		}
+		isCollapsed[i] = true
+		for j := i + 1; j < len(atoms) && atoms[j].Cause == atom.ID; j++ {
+			if _, ok := atoms[j].Value.(Delete); !ok {
+				break
+			}
+			if !isDead[j] {
+				isCollapsed[i] = false
+			}
+		}
+	}
+	// Remove dead subtrees, except for Delete atoms whose target is kept and not collapsed.
+	isRemoved := make([]bool, len(atoms))
+	for i, atom := range atoms {
+		j := positions.get(atom.Cause)
+		if j >= 0 && isRemoved[j] {
+			isRemoved[i] = true
+			continue
+		}
+		_, isDelete := atom.Value.(Delete)
+		isRemoved[i] = isDead[i] && (!isDelete || (j >= 0 && isCollapsed[j]))
+	}
+	// Move cursors out of removed subtrees and collapsed atoms.
+	keptAncestor := func(atomID AtomID) AtomID {
+		for i := positions.get(atomID); i >= 0 && (isRemoved[i] || isCollapsed[i]); i = positions.get(atomID) {
+			atomID = atoms[i].Cause
+		}
+		return atomID
+	}
+	t.Cursor = keptAncestor(t.Cursor)
+	for _, c := range t.cursors {
+		c.atomID = keptAncestor(c.atomID)
+	}
+	kept := atoms[:0]
+	for i, atom := range atoms {
+		switch {
+		case isRemoved[i]:
+			t.Yarns[atom.ID.Site][atom.ID.Index] = Atom{ID: atom.ID}
+		case isCollapsed[i]:
+			atom.Value = Tombstone{}
+			t.Yarns[atom.ID.Site][atom.ID.Index] = atom.Atom
+			kept = append(kept, atom)
+		default:
+			kept = append(kept, atom)
+		}
+	}
+	t.setWeave(buildWeave(kept))
+	// Advance horizon up to the last atom within the stable weft.
+	if t.horizon == nil {
+		t.horizon = make(Weft, len(t.Yarns))
+	}
+	for i, limit := range limits {
+		if limit == 0 {
+			continue
+		}
+		if ts := t.Yarns[i][limit-1].ID.Timestamp; ts > t.horizon[i] {
+			t.horizon[i] = ts
+		}
+	}
+}
+
+// Horizon returns the stable weft of all compactions, or nil if the tree was never compacted.
+func (t *CausalTree) Horizon() Weft {
+	if t.horizon == nil {
+		return nil
+	}
+	horizon := make(Weft, len(t.horizon))
+	copy(horizon, t.horizon)
+	return horizon
+}
+
+// Returns whether the weft, using this tree's site indices, is behind the horizon at some site.
+func (t *CausalTree) isBehindHorizon(weft Weft) bool {
+	for i, ts := range t.horizon {
+		if weft[i] < ts {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the tree has seen all atoms up to the other tree's horizon.
+//
+// Time complexity: O(sites*log(sites))
+func (t *CausalTree) hasSeenHorizon(other *CausalTree) bool {
+	now := t.Now()
+	for i, ts := range other.horizon {
+		if ts == 0 {
+			continue
+		}
+		site := other.Sitemap[i]
+		j := siteIndex(t.Sitemap, site)
+		if j == len(t.Sitemap) || t.Sitemap[j] != site || now[j] < ts {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns whether the atom was removed by Compact.
+func isCompacted(atom Atom) bool {
+	return atom.Value == nil
+}
+
+// Returns whether the atom was collapsed into a Tombstone by Compact.
+func isTombstone(atom Atom) bool {
+	_, ok := atom.Value.(Tombstone)
+	return ok
+}
+
+// Tombstone represents a deleted char or list element whose value was discarded by Compact, since
+// it still has descendants. It's always deleted, and keeps its children as the original atom.
+type Tombstone struct{}
+
+func (v Tombstone) AtomPriority() int { return tombstonePriority }
+func (v Tombstone) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"Tombstone"}`), nil
+}
+
+func (v Tombstone) String() string { return "Tombstone" }
+
+func (v Tombstone) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case InsertChar, InsertElem, InsertStr, InsertCounter, InsertList, InsertMap, InsertRegister, InsertSet, MarkStart, MarkEnd, MoveFrom, MoveTo, Tombstone:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after Tombstone: %T (%v)", child, child)
+	}
+}
+
+// Remaps the horizon to a new sitemap.
+//
+// Time complexity: O(sites)
+func (t *CausalTree) remapHorizon(m indexMap, numSites int) {
+	if t.horizon == nil {
+		return
+	}
+	horizon := make(Weft, numSites)
+	for i, ts := range t.horizon {
+		horizon[m.get(i)] = ts
+	}
+	t.horizon = horizon
+}
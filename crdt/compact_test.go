@@ -0,0 +1,268 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+// Returns the number of atoms in yarns, and how many of them were compacted.
+func countAtoms(tree *crdt.CausalTree) (total, compacted int) {
+	for _, yarn := range tree.Yarns {
+		for _, atom := range yarn {
+			total++
+			if atom.Value == nil {
+				compacted++
+			}
+		}
+	}
+	return total, compacted
+}
+
+func setupCompactTest(t *testing.T) []*crdt.CausalTree {
+	return testOperations(t, []operation{
+		{op: fork, local: 0, remote: 1},
+		{op: fork, local: 0, remote: 2},
+		// Site #0: abcdefgh -> axyzbcdefgh -> abef
+		{op: insertChar, local: 0, char: 'a'},
+		{op: insertChar, local: 0, char: 'b'},
+		{op: insertChar, local: 0, char: 'c'},
+		{op: insertChar, local: 0, char: 'd'},
+		{op: insertChar, local: 0, char: 'e'},
+		{op: insertChar, local: 0, char: 'f'},
+		{op: insertChar, local: 0, char: 'g'},
+		{op: insertChar, local: 0, char: 'h'},
+		{op: insertCharAt, local: 0, char: 'x', pos: 0},
+		{op: insertChar, local: 0, char: 'y'},
+		{op: insertChar, local: 0, char: 'z'},
+		{op: check, local: 0, str: "axyzbcdefgh"},
+		// Delete chars with live descendants (cd), and whole subtrees (xyz, gh).
+		{op: deleteCharAt, local: 0, pos: 1},
+		{op: deleteCharAt, local: 0, pos: 1},
+		{op: deleteCharAt, local: 0, pos: 1},
+		{op: deleteCharAt, local: 0, pos: 2},
+		{op: deleteCharAt, local: 0, pos: 2},
+		{op: deleteCharAt, local: 0, pos: 4},
+		{op: deleteCharAt, local: 0, pos: 4},
+		// Site #1 inserts a char concurrently, and both sites sync.
+		{op: insertChar, local: 1, char: 'Q'},
+		{op: merge, local: 0, remote: 1},
+		{op: merge, local: 1, remote: 0},
+		{op: check, local: 0, str: "abefQ"},
+		{op: check, local: 1, str: "abefQ"},
+	})
+}
+
+func TestCompact(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000003-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := setupCompactTest(t)
+	t0, t1 := trees[0], trees[1]
+	control := t0.Clone()
+	if err := t0.Compact(t0.Now()); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if s := t0.ToString(); s != "abefQ" {
+		t.Errorf("got %q, want %q", s, "abefQ")
+	}
+	// Removed 'gh', 'xyz', and their Delete atoms, and collapsed 'cd' into tombstones.
+	if total, compacted := countAtoms(t0); compacted != 12 || len(t0.Weave) != total-compacted {
+		t.Errorf("got %d compacted atoms and a weave with %d atoms, want 12 and %d", compacted, len(t0.Weave), total-12)
+	}
+	// Edits after compaction are merged in the same position as with an uncompacted tree.
+	for _, tree := range []*crdt.CausalTree{t0, control} {
+		if err := tree.InsertCharAt('V', 1); err != nil {
+			t.Fatalf("InsertCharAt: %v", err)
+		}
+	}
+	if err := t1.InsertCharAt('W', 4); err != nil {
+		t.Fatalf("InsertCharAt: %v", err)
+	}
+	for _, tree := range []*crdt.CausalTree{t0, control} {
+		if err := tree.Merge(t1); err != nil {
+			t.Fatalf("Merge: %v", err)
+		}
+	}
+	// Uncompacted tree is compacted when merging with a compacted one.
+	if err := t1.Merge(t0); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	for i, tree := range []*crdt.CausalTree{t0, t1, control} {
+		if s := tree.ToString(); s != "abVefQW" {
+			t.Errorf("tree #%d: got %q, want %q", i, s, "abVefQW")
+		}
+	}
+	if diff := cmp.Diff(t0.Weave, t1.Weave); diff != "" {
+		t.Errorf("weave (-t0, +t1):\n%s", diff)
+	}
+	if diff := cmp.Diff(t0.Horizon(), t1.Horizon()); diff != "" {
+		t.Errorf("horizon (-t0, +t1):\n%s", diff)
+	}
+	// Compacted tree can be encoded.
+	bs, err := json.Marshal(t0)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got := new(crdt.CausalTree)
+	if err := json.Unmarshal(bs, got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(t0, got, treeOpts); diff != "" {
+		t.Errorf("JSON round-trip (-want, +got):\n%s", diff)
+	}
+	bs, err = t0.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got = new(crdt.CausalTree)
+	if err := got.UnmarshalBinary(bs); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if diff := cmp.Diff(t0, got, treeOpts); diff != "" {
+		t.Errorf("binary round-trip (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCompactDeletedMiddle(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	t0 := crdt.NewCausalTree()
+	if err := t0.InsertString("abcdefghij", -1); err != nil {
+		t.Fatalf("InsertString: %v", err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	if err := t0.DeleteRange(2, 5); err != nil {
+		t.Fatalf("DeleteRange: %v", err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if err := t0.Compact(t0.Now()); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	// 'cde' are collapsed into tombstones, since 'fghij' descend from them, and their Delete atoms are removed.
+	var tombstones int
+	for _, atom := range t0.Weave {
+		switch atom.Value.(type) {
+		case crdt.Tombstone:
+			tombstones++
+		case crdt.Delete:
+			t.Errorf("weave contains Delete atom %v", atom.ID)
+		}
+	}
+	if n := len(t0.Weave); n != 10 || tombstones != 3 {
+		t.Errorf("got a weave with %d atoms and %d tombstones, want 10 and 3", n, tombstones)
+	}
+	if total, compacted := countAtoms(t0); total != 13 || compacted != 3 {
+		t.Errorf("got %d atoms in yarns, %d compacted, want 13 and 3", total, compacted)
+	}
+	if err := t0.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	// Edits around tombstones are merged in the same position as with an uncompacted tree.
+	if err := t0.InsertCharAt('X', 1); err != nil {
+		t.Fatalf("InsertCharAt: %v", err)
+	}
+	if err := t1.InsertCharAt('Y', 2); err != nil {
+		t.Fatalf("InsertCharAt: %v", err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	for i, tree := range []*crdt.CausalTree{t0, t1} {
+		if s := tree.ToString(); s != "abXfYghij" {
+			t.Errorf("tree #%d: got %q, want %q", i, s, "abXfYghij")
+		}
+		if err := tree.Validate(); err != nil {
+			t.Errorf("tree #%d: Validate: %v", i, err)
+		}
+	}
+	if diff := cmp.Diff(t0.Weave, t1.Weave); diff != "" {
+		t.Errorf("weave (-t0, +t1):\n%s", diff)
+	}
+	// Tombstones can be encoded.
+	bs, err := t0.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got := new(crdt.CausalTree)
+	if err := got.UnmarshalBinary(bs); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if diff := cmp.Diff(t0, got, treeOpts); diff != "" {
+		t.Errorf("binary round-trip (-want, +got):\n%s", diff)
+	}
+	bs, err = json.Marshal(t0)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got = new(crdt.CausalTree)
+	if err := json.Unmarshal(bs, got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(t0, got, treeOpts); diff != "" {
+		t.Errorf("JSON round-trip (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCompactError(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000003-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := setupCompactTest(t)
+	t0, t2 := trees[0], trees[2]
+	if err := t2.InsertChar('R'); err != nil {
+		t.Fatalf("InsertChar: %v", err)
+	}
+	before := t0.Now()
+	if err := t0.Compact(before); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	// Site #2 hasn't seen the deletions, so it can't merge with site #0.
+	want := t0.Clone()
+	if err := t0.Merge(t2); !errors.Is(err, crdt.ErrMergeCompacted) {
+		t.Errorf("t0.Merge(t2): got %v, want %v", err, crdt.ErrMergeCompacted)
+	}
+	if diff := cmp.Diff(want, t0, treeOpts); diff != "" {
+		t.Errorf("tree changed after error (-want, +got):\n%s", diff)
+	}
+	if err := t2.Merge(t0); !errors.Is(err, crdt.ErrMergeCompacted) {
+		t.Errorf("t2.Merge(t0): got %v, want %v", err, crdt.ErrMergeCompacted)
+	}
+	// Wefts from before the compaction are rejected.
+	past := make(crdt.Weft, len(before))
+	copy(past, before)
+	past[0]--
+	if _, err := t0.DeltaSince(past); !errors.Is(err, crdt.ErrWeftCompacted) {
+		t.Errorf("DeltaSince: got %v, want %v", err, crdt.ErrWeftCompacted)
+	}
+	if _, err := t0.ViewAt(past); !errors.Is(err, crdt.ErrWeftCompacted) {
+		t.Errorf("ViewAt: got %v, want %v", err, crdt.ErrWeftCompacted)
+	}
+	if _, err := t0.DeltaSince(before); err != nil {
+		t.Errorf("DeltaSince: got %v, want nil", err)
+	}
+}
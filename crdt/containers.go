@@ -0,0 +1,109 @@
+package crdt
+
+// +-----------------+
+// | Root containers |
+// +-----------------+
+
+// StrContainer is a String under the root, inserted with InsertStr or SetString, whose positions
+// are relative to the container instead of the whole tree. Its chars are read with Snapshot.
+type StrContainer struct {
+	String
+}
+
+// InsertCharAt inserts a char after the given (container) position. Use i = -1 to insert it at
+// the beginning.
+//
+// Time complexity: O(log(atoms) + block size + log(sites))
+func (s *StrContainer) InsertCharAt(ch rune, i int) error {
+	c := s.Cursor()
+	if err := c.Index(i); err != nil {
+		return err
+	}
+	return c.Insert(ch)
+}
+
+// DeleteCharAt deletes the char at the given (container) position.
+//
+// Time complexity: O(log(atoms) + block size + log(sites))
+func (s *StrContainer) DeleteCharAt(i int) error {
+	if i < 0 {
+		return ErrCursorOutOfRange
+	}
+	c := s.Cursor()
+	if err := c.Index(i); err != nil {
+		return err
+	}
+	return c.Delete()
+}
+
+// Delete deletes the container and all its chars.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (s *StrContainer) Delete() error {
+	_, err := s.tree.addAtomAt(s.atomID(), Delete{})
+	return err
+}
+
+// CounterContainer is a Counter under the root, inserted with InsertCounter or SetCounter. Its
+// value is read with Snapshot.
+type CounterContainer struct {
+	Counter
+}
+
+// Len returns the number of visible increments.
+//
+// Time complexity: O(log(atoms) + block size)
+func (cnt *CounterContainer) Len() int {
+	var n int
+	for _, atom := range cnt.block() {
+		if _, ok := atom.Value.(InsertAdd); ok && atom.isVisible() {
+			n++
+		}
+	}
+	return n
+}
+
+// InsertAdd adds an increment to the counter.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (cnt *CounterContainer) InsertAdd(val int32) error {
+	return cnt.Increment(val)
+}
+
+// Delete deletes the container and all its increments.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (cnt *CounterContainer) Delete() error {
+	_, err := cnt.tree.addAtomAt(cnt.atomID(), Delete{})
+	return err
+}
+
+// Containers returns handles for the visible containers under the root, in weave order. String
+// and counter containers are returned as *StrContainer and *CounterContainer, and other containers
+// as the handles returned by Value.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) Containers() []Value {
+	var values []Value
+	atoms := t.weave.weaveAtoms()
+	for i := 0; i < len(atoms); {
+		atom := atoms[i]
+		if atom.Cause.Timestamp != 0 || !isContainer(atom.Atom) {
+			i++
+			continue
+		}
+		if atom.isVisible() {
+			p := t.positionOf(atom.ID)
+			switch atom.Value.(type) {
+			case InsertStr:
+				values = append(values, &StrContainer{String{p}})
+			case InsertCounter:
+				values = append(values, &CounterContainer{Counter{p}})
+			default:
+				values = append(values, t.valueOf(atom.Atom))
+			}
+		}
+		i += weaveBlockSize(atoms, i)
+	}
+	return values
+}
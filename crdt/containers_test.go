@@ -0,0 +1,116 @@
+package crdt_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+)
+
+var (
+	_ crdt.Container = (*crdt.StrContainer)(nil)
+	_ crdt.Container = (*crdt.CounterContainer)(nil)
+)
+
+func TestContainers(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	steps := []func() error{
+		tree.InsertStr,
+		func() error { return tree.InsertChar('a') },
+		func() error { return tree.InsertChar('b') },
+		func() error { return tree.InsertChar('c') },
+		tree.InsertCounter,
+		func() error { return tree.InsertAdd(3) },
+		func() error { return tree.InsertAdd(-1) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+	}
+	containers := tree.Containers()
+	if len(containers) != 2 {
+		t.Fatalf("got %d containers, want 2", len(containers))
+	}
+	// Newest containers come first in the weave.
+	cnt, ok := containers[0].(*crdt.CounterContainer)
+	if !ok {
+		t.Fatalf("containers[0] is %T, want *crdt.CounterContainer", containers[0])
+	}
+	s, ok := containers[1].(*crdt.StrContainer)
+	if !ok {
+		t.Fatalf("containers[1] is %T, want *crdt.StrContainer", containers[1])
+	}
+	if got := s.Snapshot(); got != "abc" {
+		t.Errorf("s.Snapshot() = %q, want %q", got, "abc")
+	}
+	if got := cnt.Snapshot(); got != 2 {
+		t.Errorf("cnt.Snapshot() = %d, want 2", got)
+	}
+	if got := cnt.Len(); got != 2 {
+		t.Errorf("cnt.Len() = %d, want 2", got)
+	}
+
+	// Positions are relative to each container.
+	tests := []struct {
+		f       func() error
+		wantStr string
+		wantCnt int32
+	}{
+		{func() error { return s.InsertCharAt('x', 0) }, "axbc", 2},
+		{func() error { return s.DeleteCharAt(3) }, "axb", 2},
+		{func() error { return s.InsertCharAt('_', -1) }, "_axb", 2},
+		{func() error { return cnt.InsertAdd(5) }, "_axb", 7},
+		{tree.Undo, "_axb", 2},
+		{tree.Undo, "axb", 2},
+	}
+	for i, test := range tests {
+		if err := test.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if got := s.Snapshot(); got != test.wantStr {
+			t.Errorf("step #%d: s.Snapshot() = %q, want %q", i, got, test.wantStr)
+		}
+		if got := cnt.Snapshot(); got != test.wantCnt {
+			t.Errorf("step #%d: cnt.Snapshot() = %d, want %d", i, got, test.wantCnt)
+		}
+	}
+	if s.Len() != 3 {
+		t.Errorf("s.Len() = %d, want 3", s.Len())
+	}
+	if err := s.DeleteCharAt(3); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+		t.Errorf("DeleteCharAt(3): got err %v, want %v", err, crdt.ErrCursorOutOfRange)
+	}
+	if err := s.DeleteCharAt(-1); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+		t.Errorf("DeleteCharAt(-1): got err %v, want %v", err, crdt.ErrCursorOutOfRange)
+	}
+
+	// Deleted containers are not returned.
+	if err := cnt.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	containers = tree.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers after delete, want 1", len(containers))
+	}
+	if got := containers[0].(*crdt.StrContainer).Snapshot(); got != "axb" {
+		t.Errorf("Value() = %q, want %q", got, "axb")
+	}
+	if got := tree.ToString(); got != "*axb" {
+		t.Errorf("ToString() = %q, want %q", got, "*axb")
+	}
+}
+
+func TestContainersNested(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if _, err := tree.SetList(); err != nil {
+		t.Fatal(err)
+	}
+	containers := tree.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers, want 1", len(containers))
+	}
+	if _, ok := containers[0].(*crdt.List); !ok {
+		t.Errorf("containers[0] is %T, want *crdt.List", containers[0])
+	}
+}
@@ -0,0 +1,44 @@
+package crdt
+
+// +---------------+
+// | Counter value |
+// +---------------+
+
+// Counter is a mutable integer that may be incremented and decremented concurrently.
+type Counter struct {
+	treePosition
+}
+
+func (*Counter) isValue() {}
+
+// Snapshot returns the sum of all visible increments.
+//
+// Time complexity: O(log(atoms) + block size)
+func (cnt *Counter) Snapshot() int32 {
+	return snapshotCounter(cnt.block())
+}
+
+func snapshotCounter(block []weaveAtom) int32 {
+	var sum int32
+	for _, atom := range block {
+		if value, ok := atom.Value.(InsertAdd); ok && atom.isVisible() {
+			sum += value.Value
+		}
+	}
+	return sum
+}
+
+// Increment adds x to the counter.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (cnt *Counter) Increment(x int32) error {
+	_, err := cnt.tree.addAtomAt(cnt.atomID(), InsertAdd{x})
+	return err
+}
+
+// Decrement subtracts x from the counter.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (cnt *Counter) Decrement(x int32) error {
+	return cnt.Increment(-x)
+}
@@ -46,11 +46,11 @@ When inserting a char, for example, its cause is the char to its left.
 
 Instead of using a pointer to reference the causing operation, references simply hold an atom
 ID containing the origin site and the (local) timestamp of creation.
-Atoms are then organized in an array to improve memory locality, at the expanse of having to
-search linearly for a given atom ID.
+Atoms are then organized in an array to improve memory locality, that is stored in chunks
+within a balanced tree to allow fast inserts (see weave.go).
 
-By sorting the array such that atoms from the same site and time are mostly contiguous, this search
-operation is not terribly costly, and the array reads almost like the structure being represented.
+By sorting the array such that atoms from the same site and time are mostly contiguous, the array
+reads almost like the structure being represented.
 
   # BEGIN ASCII ART
 
@@ -105,6 +105,7 @@ type AtomID struct {
 
 // AtomValue is a tree operation.
 type AtomValue interface {
+	// MarshalJSON encodes the value as an object with a "Type" tag, that can be decoded with Atom.UnmarshalJSON.
 	json.Marshaler
 	// AtomPriority returns where this atom should be placed compared with its siblings.
 	AtomPriority() int
@@ -116,9 +117,12 @@ type AtomValue interface {
 //
 // This data structure allows for 64K sites and 4G atoms in total.
 type CausalTree struct {
-	// Weave is the flat representation of a causal tree.
+	// Weave is the flat representation of a causal tree. It mirrors the atoms stored in a balanced
+	// tree of chunks, which is used for all operations, and it's kept up to date by them. Modifying
+	// it doesn't affect the tree.
 	Weave []Atom
-	// Cursor is the ID of the causing atom for the next operation.
+	// Cursor is the ID of the causing atom for the next operation. Independent cursors may be created
+	// with NewCursor.
 	Cursor AtomID
 	// Yarns is the list of atoms, grouped by the site that created them.
 	Yarns [][]Atom
@@ -129,13 +133,24 @@ type CausalTree struct {
 	SiteID uuid.UUID
 	// Timestamp is this tree's Lamport timestamp.
 	Timestamp uint32
+
+	// Atoms in weave order, stored in a balanced tree of chunks.
+	weave *weave
+	// Stable weft of all compactions, using the sitemap's indices. Nil if never compacted.
+	horizon Weft
+	// Remote atoms waiting for their cause or yarn predecessor to be integrated.
+	pending map[yarnPosition][]Atom
+	// Operations made by this site, for undo and redo.
+	history undoHistory
+	// Cursor handles created with NewCursor.
+	cursors []*Cursor
 }
 
 // NewCausalTree creates an initialized empty replicated tree.
 func NewCausalTree() *CausalTree {
 	siteID := uuidv1()
 	return &CausalTree{
-		Weave:     nil,
+		weave:     newWeave(nil),
 		Cursor:    AtomID{},
 		Yarns:     [][]Atom{nil},
 		Sitemap:   []uuid.UUID{siteID},
@@ -155,17 +170,15 @@ func siteIndex(sitemap []uuid.UUID, siteID uuid.UUID) int {
 
 // Returns the index of an atom within the weave.
 //
-// Time complexity: O(atoms)
+// Time complexity: O(log(atoms))
 func (t *CausalTree) atomIndex(atomID AtomID) int {
 	if atomID.Timestamp == 0 {
 		return -1
 	}
-	for i, atom := range t.Weave {
-		if atom.ID == atomID {
-			return i
-		}
+	if i := t.weave.indexOf(atomID); i >= 0 {
+		return i
 	}
-	return len(t.Weave)
+	return t.weave.len()
 }
 
 // Gets an atom from yarns.
@@ -177,13 +190,22 @@ func (t *CausalTree) getAtom(atomID AtomID) Atom {
 
 // Inserts an atom in the given weave index.
 //
-// Time complexity: O(atoms)
+// Time complexity: O(log(atoms)), plus shifting the atoms after it in the Weave field
 func (t *CausalTree) insertAtom(atom Atom, i int) {
+	t.weave.insert(i, atom)
 	t.Weave = append(t.Weave, Atom{})
 	copy(t.Weave[i+1:], t.Weave[i:])
 	t.Weave[i] = atom
 }
 
+// Replaces the weave, updating the Weave field with its flat representation.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) setWeave(w *weave) {
+	t.weave = w
+	t.Weave = w.atoms()
+}
+
 // +--------+
 // | String |
 // +--------+
@@ -265,7 +287,11 @@ func (a Atom) remapSite(m indexMap) Atom {
 	}
 }
 
+// The root ID doesn't belong to any site, and is kept as is.
 func (id AtomID) remapSite(m indexMap) AtomID {
+	if id.Timestamp == 0 {
+		return id
+	}
 	return AtomID{
 		Site:      uint16(m.get(int(id.Site))),
 		Index:     id.Index,
@@ -273,6 +299,27 @@ func (id AtomID) remapSite(m indexMap) AtomID {
 	}
 }
 
+// Remaps the site of all atoms referenced by the tree. Yarns are not reordered.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) remapAtoms(m indexMap) {
+	for _, yarn := range t.Yarns {
+		for j, atom := range yarn {
+			yarn[j] = atom.remapSite(m)
+		}
+	}
+	t.weave.remapSite(m)
+	for i, atom := range t.Weave {
+		t.Weave[i] = atom.remapSite(m)
+	}
+	t.Cursor = t.Cursor.remapSite(m)
+	for _, c := range t.cursors {
+		c.atomID = c.atomID.remapSite(m)
+	}
+	t.remapPending(m)
+	t.history.remapSite(m)
+}
+
 // +------+
 // | Fork |
 // +------+
@@ -289,21 +336,15 @@ func (t *CausalTree) Fork() (*CausalTree, error) {
 	if i == len(t.Sitemap) {
 		t.Yarns = append(t.Yarns, nil)
 		t.Sitemap = append(t.Sitemap, newSiteID)
+		t.remapHorizon(nil, len(t.Sitemap))
 	} else {
 		// Remap atoms in yarns and weave.
 		localRemap := make(indexMap)
 		for j := i; j < len(t.Sitemap); j++ {
 			localRemap.set(j, j+1)
 		}
-		for i, yarn := range t.Yarns {
-			for j, atom := range yarn {
-				t.Yarns[i][j] = atom.remapSite(localRemap)
-			}
-		}
-		for i, atom := range t.Weave {
-			t.Weave[i] = atom.remapSite(localRemap)
-		}
-		t.Cursor = t.Cursor.remapSite(localRemap)
+		t.remapAtoms(localRemap)
+		t.remapHorizon(localRemap, len(t.Sitemap)+1)
 		// Insert empty yarn in local position.
 		t.Yarns = append(t.Yarns, nil)
 		copy(t.Yarns[i+1:], t.Yarns[i:])
@@ -318,17 +359,19 @@ func (t *CausalTree) Fork() (*CausalTree, error) {
 	t.Timestamp++
 	remote := &CausalTree{
 		Weave:     make([]Atom, len(t.Weave)),
+		weave:     t.weave.clone(),
+		horizon:   t.Horizon(),
 		Cursor:    t.Cursor,
 		Yarns:     make([][]Atom, n),
 		Sitemap:   make([]uuid.UUID, n),
 		SiteID:    newSiteID,
 		Timestamp: t.Timestamp,
 	}
-	copy(remote.Weave, t.Weave)
 	for i, yarn := range t.Yarns {
 		remote.Yarns[i] = make([]Atom, len(yarn))
 		copy(remote.Yarns[i], yarn)
 	}
+	copy(remote.Weave, t.Weave)
 	copy(remote.Sitemap, t.Sitemap)
 	return remote, nil
 }
@@ -410,14 +453,18 @@ func mergeWeaves(w1, w2 []Atom) []Atom {
 	return weave
 }
 
-// Merge updates the current state with that of another remote tree.
-// Note that merge does not move the cursor.
+// Minimum ratio between the weave size and the number of new atoms from a remote tree to merge
+// them one by one, instead of merging the whole weaves.
+const incrementalMergeRatio = 16
+
+// Merges the remote sitemap into the local one, remapping local atoms to their new site indices.
+// Returns the remapping from remote site indices to the merged sitemap.
 //
-// Time complexity: O(atoms^2 + sites*log(sites))
-func (t *CausalTree) Merge(remote *CausalTree) {
+// Time complexity: O(atoms + sites*log(sites))
+func (t *CausalTree) mergeSitemap(remoteSitemap []uuid.UUID) indexMap {
 	// 1. Merge sitemaps.
 	// Time complexity: O(sites)
-	sitemap := mergeSitemaps(t.Sitemap, remote.Sitemap)
+	sitemap := mergeSitemaps(t.Sitemap, remoteSitemap)
 
 	// 2. Compute site index remapping.
 	// Time complexity: O(sites*log(sites))
@@ -426,67 +473,114 @@ func (t *CausalTree) Merge(remote *CausalTree) {
 	for i, site := range t.Sitemap {
 		localRemap.set(i, siteIndex(sitemap, site))
 	}
-	for i, site := range remote.Sitemap {
+	for i, site := range remoteSitemap {
 		remoteRemap.set(i, siteIndex(sitemap, site))
 	}
 
 	// 3. Remap atoms from local.
 	// Time complexity: O(atoms)
-	yarns := make([][]Atom, len(sitemap))
 	if len(localRemap) > 0 {
-		for i, yarn := range t.Yarns {
-			i := localRemap.get(i)
-			yarns[i] = make([]Atom, len(yarn))
-			for j, atom := range yarn {
-				yarns[i][j] = atom.remapSite(localRemap)
-			}
-		}
-		for i, atom := range t.Weave {
-			t.Weave[i] = atom.remapSite(localRemap)
-		}
-	} else {
-		for i, yarn := range t.Yarns {
-			yarns[i] = make([]Atom, len(yarn))
-			copy(yarns[i], yarn)
-		}
+		t.remapAtoms(localRemap)
+	}
+	yarns := make([][]Atom, len(sitemap))
+	for i, yarn := range t.Yarns {
+		yarns[localRemap.get(i)] = yarn
+	}
+	t.Yarns = yarns
+	t.Sitemap = sitemap
+	t.remapHorizon(localRemap, len(sitemap))
+	return remoteRemap
+}
+
+// Merge updates the current state with that of another remote tree.
+// Note that merge does not move the cursor.
+//
+// It returns an error if either tree hasn't seen all atoms up to the stable weft of a compaction
+// in the other, in which case the tree is not modified.
+//
+// Time complexity: O(atoms + sites*log(sites))
+func (t *CausalTree) Merge(remote *CausalTree) error {
+	// 0. Check that trees are not behind each other's compaction.
+	// Time complexity: O(sites*log(sites))
+	if !t.hasSeenHorizon(remote) || !remote.hasSeenHorizon(t) {
+		return ErrMergeCompacted
 	}
 
+	// 1-3. Merge sitemaps and remap local atoms.
+	// Time complexity: O(atoms + sites*log(sites))
+	remoteRemap := t.mergeSitemap(remote.Sitemap)
+
 	// 4. Merge yarns.
 	// Time complexity: O(atoms)
+	var newAtoms []Atom
 	for i, yarn := range remote.Yarns {
 		i := remoteRemap.get(i)
-		start := len(yarns[i])
-		end := len(yarn)
-		if end > start {
-			// Grow yarn to accomodate remote atoms.
-			yarns[i] = append(yarns[i], make([]Atom, end-start)...)
-		}
-		for j := start; j < end; j++ {
+		for j := len(t.Yarns[i]); j < len(yarn); j++ {
 			atom := yarn[j].remapSite(remoteRemap)
-			yarns[i][j] = atom
+			t.Yarns[i] = append(t.Yarns[i], atom)
+			newAtoms = append(newAtoms, atom)
 		}
 	}
 
 	// 5. Merge weaves.
-	// Time complexity: O(atoms)
-	remoteWeave := make([]Atom, len(remote.Weave))
-	for i, atom := range remote.Weave {
-		remoteWeave[i] = atom.remapSite(remoteRemap)
+	// If there are few new atoms, insert them one by one in causal order. Otherwise, merge
+	// the whole weaves.
+	// Time complexity: O(atoms), or O((new atoms) * (log(atoms) + avg. block size))
+	if len(newAtoms)*incrementalMergeRatio < t.weave.len() {
+		sort.Slice(newAtoms, func(i, j int) bool {
+			return newAtoms[i].ID.Compare(newAtoms[j].ID) < 0
+		})
+		for _, atom := range newAtoms {
+			t.insertRemoteAtom(atom)
+		}
+	} else if len(newAtoms) > 0 {
+		remoteWeave := remote.weave.atoms()
+		n := 0
+		for _, atom := range remoteWeave {
+			atom = atom.remapSite(remoteRemap)
+			local := t.getAtom(atom.ID)
+			if isCompacted(local) {
+				// Skip atoms removed locally.
+				continue
+			}
+			// Atoms collapsed into tombstones by only one of the trees are taken as they are locally,
+			// and collapsed in step 8 if necessary.
+			remoteWeave[n] = local
+			n++
+		}
+		t.setWeave(newWeave(mergeWeaves(t.weave.atoms(), remoteWeave[:n])))
 	}
-	t.Weave = mergeWeaves(t.Weave, remoteWeave)
 
-	// Move created stuff to this tree.
-	t.Yarns = yarns
-	t.Sitemap = sitemap
+	// Update Lamport timestamp.
 	if t.Timestamp < remote.Timestamp {
 		t.Timestamp = remote.Timestamp
 	}
 	t.Timestamp++
 
 	// 6. Fix cursor if necessary.
-	// Time complexity: O(atoms^2)
-	t.Cursor = t.Cursor.remapSite(localRemap)
+	// Time complexity: O(avg. tree height)
 	t.fixDeletedCursor()
+
+	// 7. Integrate pending atoms whose causes may have arrived.
+	t.flushPending()
+
+	// 8. Remove atoms that were compacted in remote.
+	// Both horizons were checked to be connected when compacting, and both trees have seen them,
+	// so their join doesn't need to be checked again.
+	// Time complexity: O(atoms)
+	stable := make(Weft, len(t.Sitemap))
+	copy(stable, t.horizon)
+	var isAhead bool
+	for i, ts := range remote.horizon {
+		if i := remoteRemap.get(i); stable[i] < ts {
+			stable[i] = ts
+			isAhead = true
+		}
+	}
+	if isAhead {
+		t.compact(t.weftLimits(stable))
+	}
+	return nil
 }
 
 // -----
@@ -516,18 +610,6 @@ func walkCausalBlock(block []Atom, f func(Atom) bool) int {
 	return len(block)
 }
 
-// Invokes the closure f with each direct children of the block's head.
-//
-// The index i corresponds to the index on the causal block, not on the child's order.
-func walkChildren(block []Atom, f func(Atom) bool) {
-	walkCausalBlock(block, func(atom Atom) bool {
-		if atom.Cause == block[0].ID {
-			return f(atom)
-		}
-		return true
-	})
-}
-
 // Returns the size of the causal block, including its head.
 func causalBlockSize(block []Atom) int {
 	return walkCausalBlock(block, func(atom Atom) bool { return true })
@@ -535,41 +617,32 @@ func causalBlockSize(block []Atom) int {
 
 // Returns whether the atom is deleted.
 //
-// Time complexity: O(atoms), or, O(avg. block size)
+// Time complexity: O(1)
 func (t *CausalTree) isDeleted(atomID AtomID) bool {
-	i := t.atomIndex(atomID)
-	if i < 0 {
-		return false
-	}
-	var isDeleted bool
-	walkChildren(t.Weave[i:], func(child Atom) bool {
-		if _, ok := child.Value.(Delete); ok {
-			isDeleted = true
-			return false
-		}
-		// There's a child with lower priority than delete, so there can't be
-		// any more delete atom ahead.
-		if child.Value.AtomPriority() < (Delete{}).AtomPriority() {
-			isDeleted = false
-			return false
-		}
-		return true
-	})
-	return isDeleted
+	leaf, i := t.weave.lookup(atomID)
+	return leaf != nil && leaf.atoms[i].isDeleted
 }
 
-// Ensure tree's cursor isn't deleted, finding the first non-deleted ancestor.
+// Ensure tree's cursors aren't deleted, finding their first non-deleted ancestor.
 //
-// Time complexity: O(atoms^2), or, O((avg. tree height) * (avg. block size))
+// Time complexity: O(cursors * avg. tree height)
 func (t *CausalTree) fixDeletedCursor() {
-	for {
-		if !t.isDeleted(t.Cursor) {
-			break
-		}
-		t.Cursor = t.getAtom(t.Cursor).Cause
+	t.Cursor = t.undeletedAncestor(t.Cursor)
+	for _, c := range t.cursors {
+		c.atomID = t.undeletedAncestor(c.atomID)
 	}
 }
 
+// Returns the atom itself, if it's not deleted, or its first non-deleted ancestor.
+//
+// Time complexity: O(avg. tree height)
+func (t *CausalTree) undeletedAncestor(atomID AtomID) AtomID {
+	for t.isDeleted(atomID) {
+		atomID = t.getAtom(atomID).Cause
+	}
+	return atomID
+}
+
 // +-------------+
 // + Time travel |
 // +-------------+
@@ -578,6 +651,9 @@ func (t *CausalTree) fixDeletedCursor() {
 //
 // In a distributed system it's not possible to observe the whole state at an absolute time,
 // but we can view the site's state at each site time.
+//
+// A weft is indexed by the tree's sitemap, that changes with Fork and Merge. Use SiteWeft to store
+// wefts or exchange them with other trees.
 type Weft []uint32
 
 // Compare returns -1, +1 and 0 if this is weft is less than, greater than, or concurrent
@@ -618,14 +694,10 @@ func (ixs indexWeft) isInView(id AtomID) bool {
 	return int(id.Index) < ixs[id.Site] || id.Timestamp == 0
 }
 
-// Checks that the weft is well-formed, not disconnecting atoms from their causes
-// in other sites.
+// Returns the number of atoms within the weft at each yarn, without checking that it's well-formed.
 //
 // Time complexity: O(atoms)
-func (t *CausalTree) checkWeft(weft Weft) (indexWeft, error) {
-	if len(t.Yarns) != len(weft) {
-		return nil, ErrWeftInvalidLength
-	}
+func (t *CausalTree) weftLimits(weft Weft) indexWeft {
 	// Initialize limits at each yarn.
 	limits := make(indexWeft, len(weft))
 	for i, yarn := range t.Yarns {
@@ -641,6 +713,18 @@ func (t *CausalTree) checkWeft(weft Weft) (indexWeft, error) {
 			}
 		}
 	}
+	return limits
+}
+
+// Checks that the weft is well-formed, not disconnecting atoms from their causes
+// in other sites.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) checkWeft(weft Weft) (indexWeft, error) {
+	if len(t.Yarns) != len(weft) {
+		return nil, ErrWeftInvalidLength
+	}
+	limits := t.weftLimits(weft)
 	// Verify that all causes are present at the weft cut.
 	for i, yarn := range t.Yarns {
 		limit := limits[i]
@@ -674,18 +758,22 @@ func (t *CausalTree) ViewAt(weft Weft) (*CausalTree, error) {
 	if err != nil {
 		return nil, err
 	}
+	if t.isBehindHorizon(weft) {
+		return nil, ErrWeftCompacted
+	}
 	n := len(limits)
 	yarns := make([][]Atom, n)
 	for i, yarn := range t.Yarns {
 		yarns[i] = make([]Atom, limits[i])
 		copy(yarns[i], yarn)
 	}
-	weave := make([]Atom, 0, len(t.Weave))
-	for _, atom := range t.Weave {
+	weave := make([]Atom, 0, t.weave.len())
+	t.weave.walk(0, func(atom Atom) bool {
 		if limits.isInView(atom.ID) {
 			weave = append(weave, atom)
 		}
-	}
+		return true
+	})
 	sitemap := make([]uuid.UUID, n)
 	copy(sitemap, t.Sitemap)
 	// Set cursor, if it still exists in this view.
@@ -698,6 +786,8 @@ func (t *CausalTree) ViewAt(weft Weft) (*CausalTree, error) {
 	tmax := weft[i]
 	view := &CausalTree{
 		Weave:     weave,
+		weave:     newWeave(weave),
+		horizon:   t.Horizon(),
 		Cursor:    cursor,
 		Yarns:     yarns,
 		Sitemap:   sitemap,
@@ -719,47 +809,82 @@ var (
 	ErrCursorOutOfRange   = errors.New("cursor index out of range")
 	ErrWeftInvalidLength  = errors.New("weft length doesn't match with number of sites")
 	ErrWeftDisconnected   = errors.New("weft disconnects some atom from its cause")
+	ErrUnknownSite        = errors.New("atom refers to a site not in sitemap")
+	ErrInvalidAtom        = errors.New("atom is inconsistent with its cause or yarn")
+	ErrInvalidScalar      = errors.New("value must be a string, integer, bool or finite float")
 )
 
 // +------------+
 // | Operations |
 // +------------+
 
-// Time complexity: O(atoms), or, O(atoms + (avg. block size))
-func (t *CausalTree) insertAtomAtCursor(atom Atom) {
-	if t.Cursor.Timestamp == 0 {
-		// Cursor is at initial position.
+// Inserts the atom in the weave as a child of its cause.
+//
+// Time complexity: O(log(atoms) + (avg. block size))
+func (t *CausalTree) insertAtomAtCause(atom Atom) {
+	if atom.Cause.Timestamp == 0 {
+		// Cause is the root atom.
 		t.insertAtom(atom, 0)
 		return
 	}
 	// Search for position in weave that atom should be inserted, in a way that it's sorted relative to
 	// other children in descending order.
 	//
-	//                                  causal block of cursor
+	//                                  causal block of cause
 	//                      ------------------------------------------------
-	// Weave:           ... [cursor] [child1] ... [child2] ... [child3] ... [not child]
-	// Block indices:           0         1          c2'          c3'           end'
-	// Weave indices:          c0        c1          c2           c3            end
-	c0 := t.atomIndex(t.Cursor)
-	var pos, i int
-	walkCausalBlock(t.Weave[c0:], func(a Atom) bool {
-		i++
-		if a.Cause == t.Cursor && a.Compare(atom) < 0 && pos == 0 {
+	// Weave:           ... [cause] [child1] ... [child2] ... [child3] ... [not child]
+	// Block indices:          0         1          c2'          c3'           end'
+	// Weave indices:         c0        c1          c2           c3            end
+	c0 := t.atomIndex(atom.Cause)
+	index := c0 + 1
+	t.weave.walk(index, func(a Atom) bool {
+		if a.Cause.Timestamp < atom.Cause.Timestamp {
+			// a is the end of the causal block.
+			return false
+		}
+		if a.Cause == atom.Cause && a.Compare(atom) < 0 {
 			// a is the first child smaller than atom.
-			pos = i
+			return false
 		}
+		index++
 		return true
 	})
-	index := c0 + i + 1
-	if pos > 0 {
-		index = c0 + pos
+	t.insertAtom(atom, index)
+}
+
+// Inserts an atom created by any site in the weave, possibly older than other atoms.
+//
+// Children of the root are sorted from newest to oldest, as if each one was inserted first when it
+// was created, while insertAtomAtCause always inserts them first.
+//
+// Time complexity: O(log(atoms) + (avg. block size)), or O(atoms) for children of the root
+func (t *CausalTree) insertRemoteAtom(atom Atom) {
+	if atom.Cause.Timestamp > 0 {
+		t.insertAtomAtCause(atom)
+		return
+	}
+	// Skip the causal blocks of newer children of the root.
+	index := 0
+	for index < t.weave.len() {
+		head := t.weave.get(index)
+		if head.ID.Compare(atom.ID) < 0 {
+			break
+		}
+		index++
+		t.weave.walk(index, func(a Atom) bool {
+			if a.Cause.Timestamp < head.ID.Timestamp {
+				return false
+			}
+			index++
+			return true
+		})
 	}
 	t.insertAtom(atom, index)
 }
 
 // Inserts the atom as a child of the cursor, and returns its ID.
 //
-// Time complexity: O(atoms + log(sites))
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
 func (t *CausalTree) addAtom(value AtomValue) (AtomID, error) {
 	t.Timestamp++
 	if t.Timestamp == 0 {
@@ -783,8 +908,9 @@ func (t *CausalTree) addAtom(value AtomValue) (AtomID, error) {
 		Cause: t.Cursor,
 		Value: value,
 	}
-	t.insertAtomAtCursor(atom)
+	t.insertAtomAtCause(atom)
 	t.Yarns[i] = append(t.Yarns[i], atom)
+	t.history.record(atomID.Index)
 	return atomID, nil
 }
 
@@ -795,7 +921,7 @@ func (t *CausalTree) addAtom(value AtomValue) (AtomID, error) {
 // Auxiliary function that checks if 'atom' is a container.
 func isContainer(atom Atom) bool {
 	switch atom.Value.(type) {
-	case InsertStr, InsertCounter:
+	case InsertStr, InsertCounter, InsertList, InsertMap, InsertRegister, InsertSet:
 		return true
 	default:
 		return false
@@ -803,58 +929,54 @@ func isContainer(atom Atom) bool {
 
 }
 
-// Deletes all the descendants of atom into the weave.
-// Time complexity: O(len(block))
-func deleteDescendants(block []Atom, atomIndex int) {
-	causalBlockSz := causalBlockSize(block[atomIndex:])
-	for i := 0; i < causalBlockSz; i++ {
-		block[atomIndex+i] = Atom{}
+// Visible atoms of the tree in the order they are shown, taking moves into account. See flatOrder.
+type flatView struct {
+	atoms                    []weaveAtom
+	order, places, positions []int
+}
+
+// Returns the order in which visible atoms are shown.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) flatView() flatView {
+	atoms := t.weave.weaveAtoms()
+	order, places, positions := flatOrder(atoms)
+	return flatView{atoms, order, places, positions}
+}
+
+// Returns the atom shown at the i-th position.
+func (v flatView) atom(i int) Atom {
+	return v.atoms[v.order[i]].Atom
+}
+
+// Returns the visible atoms in the order they are shown.
+func (v flatView) shownAtoms() []Atom {
+	atoms := make([]Atom, len(v.order))
+	for i := range v.order {
+		atoms[i] = v.atom(i)
 	}
+	return atoms
 }
 
+// Returns the atoms that are not deleted, in the order they are shown.
+//
 // Time complexity: O(atoms)
 func (t *CausalTree) filterDeleted() []Atom {
-	atoms := make([]Atom, len(t.Weave))
-	copy(atoms, t.Weave)
-	indices := make(map[AtomID]int)
-	var hasDelete bool
-	for i, atom := range t.Weave {
-		indices[atom.ID] = i
+	if !t.weave.hasMoves() {
+		return t.weave.visibleAtoms()
 	}
-	for i, atom := range t.Weave {
-		if _, ok := atom.Value.(Delete); ok {
-			hasDelete = true
-			// Deletion must always come after deleted atom, so
-			// indices map must have the cause location.
-			deletedAtomIdx := indices[atom.Cause]
-			if isContainer(atoms[deletedAtomIdx]) {
-				deleteDescendants(atoms, deletedAtomIdx)
-			} else {
-				atoms[i] = Atom{}              //Delete the "Delete" atom
-				atoms[deletedAtomIdx] = Atom{} //Delete the target atom
-			}
-		}
-	}
-	if !hasDelete {
-		// Cheap optimization for case where there are no deletions.
-		return atoms
-	}
-	// Move chars to fill in holes of empty atoms.
-	deleted := 0
-	for i, atom := range atoms {
-		if atom.ID.Timestamp == 0 {
-			deleted++
-		} else {
-			atoms[i-deleted] = atoms[i]
-		}
-	}
-	atoms = atoms[:len(atoms)-deleted]
-	return atoms
+	return t.flatView().shownAtoms()
 }
 
 // Sets cursor to the given (tree) position.
 //
+// Tree positions count visible atoms in the order they are shown by ToString, so moved chars and
+// list elements are at the position they were moved to. The cursor is then set to the place of
+// their move, so that inserted atoms follow them.
+//
 // To insert an atom at the beginning, use i = -1.
+//
+// Time complexity: O(log(atoms)), or O(atoms) if some atom was moved
 func (t *CausalTree) SetCursor(i int) error {
 	if i < 0 {
 		if i == -1 {
@@ -863,23 +985,87 @@ func (t *CausalTree) SetCursor(i int) error {
 		}
 		return ErrCursorOutOfRange
 	}
-	atoms := t.filterDeleted()
-	if i >= len(atoms) {
+	if t.weave.hasMoves() {
+		v := t.flatView()
+		if i >= len(v.order) {
+			return ErrCursorOutOfRange
+		}
+		t.Cursor = v.atoms[v.places[i]].ID
+		return nil
+	}
+	if i >= t.weave.visibleLen() {
 		return ErrCursorOutOfRange
 	}
-	t.Cursor = atoms[i].ID
+	t.Cursor = t.weave.findVisible(i).ID
 	return nil
 }
 
+// AtomAt returns the ID of the atom at the given (tree) position.
+//
+// Time complexity: O(log(atoms)), or O(atoms) if some atom was moved
+func (t *CausalTree) AtomAt(i int) (AtomID, error) {
+	if t.weave.hasMoves() {
+		v := t.flatView()
+		if i < 0 || i >= len(v.order) {
+			return AtomID{}, ErrCursorOutOfRange
+		}
+		return v.atom(i).ID, nil
+	}
+	if i < 0 || i >= t.weave.visibleLen() {
+		return AtomID{}, ErrCursorOutOfRange
+	}
+	return t.weave.findVisible(i).ID, nil
+}
+
+// IndexOf returns the (tree) position of an atom, and whether it's visible.
+//
+// If the atom is hidden, e.g., it was deleted, it returns the position of the closest visible
+// atom before it, which is where its position collapsed to. The root atom, and atoms without a
+// visible atom before them, have position -1, as in SetCursor. Unknown atoms, including those
+// removed by Compact, also return -1.
+//
+// Time complexity: O(log(atoms)), or O(atoms) if some atom was moved
+func (t *CausalTree) IndexOf(atomID AtomID) (int, bool) {
+	if atomID.Timestamp == 0 {
+		return -1, true
+	}
+	leaf, j := t.weave.lookup(atomID)
+	if leaf == nil {
+		return -1, false
+	}
+	if t.weave.hasMoves() {
+		v := t.flatView()
+		j := t.atomIndex(atomID)
+		i := v.positions[j]
+		return i, i >= 0 && v.order[i] == j
+	}
+	i := t.weave.visibleBefore(leaf, j)
+	if !leaf.atoms[j].isVisible() {
+		return i - 1, false
+	}
+	return i, true
+}
+
 // +--------------------------------------+
 // + Operations - Atom Priority constants |
 // +--------------------------------------+
 const (
-	insertCharPriority    = 0
-	insertStrPriority     = 30
-	deletePriority        = 100
-	insertCounterPriority = 30
-	insertAddPriority     = 30
+	insertCharPriority     = 0
+	insertStrPriority      = 30
+	deletePriority         = 100
+	insertCounterPriority  = 30
+	insertAddPriority      = 30
+	insertListPriority     = 30
+	insertElemPriority     = 0
+	insertMapPriority      = 30
+	insertKeyPriority      = 0
+	insertRegisterPriority = 30
+	setPriority            = 0
+	insertSetPriority      = 30
+	insertMemberPriority   = 0
+	markPriority           = 50
+	movePriority           = 0
+	tombstonePriority      = 0
 )
 
 // +--------------------------+
@@ -894,13 +1080,16 @@ type InsertChar struct {
 
 func (v InsertChar) AtomPriority() int { return insertCharPriority }
 func (v InsertChar) MarshalJSON() ([]byte, error) {
-	return json.Marshal(fmt.Sprintf("insert %c", v.Char))
+	return json.Marshal(struct {
+		Type string
+		Char string
+	}{"InsertChar", string(v.Char)})
 }
 func (v InsertChar) String() string { return string([]rune{v.Char}) }
 
 func (v InsertChar) ValidateChild(child AtomValue) error {
 	switch child.(type) {
-	case InsertChar, Delete:
+	case InsertChar, MarkStart, MarkEnd, MoveFrom, MoveTo, Tombstone, Delete:
 		return nil
 	default:
 		return fmt.Errorf("invalid atom value after InsertChar: %T (%v)", child, child)
@@ -934,7 +1123,7 @@ type Delete struct{}
 
 func (v Delete) AtomPriority() int { return deletePriority }
 func (v Delete) MarshalJSON() ([]byte, error) {
-	return []byte(`"delete"`), nil
+	return []byte(`{"Type":"Delete"}`), nil
 }
 func (v Delete) String() string { return "⌫ " }
 
@@ -943,13 +1132,21 @@ func (v Delete) ValidateChild(child AtomValue) error {
 }
 
 // DeleteChar deletes the char at the cursor position, and relocates the cursor to its cause.
+// If the cursor is at a MoveTo, the moved char is deleted instead, and the cursor is relocated
+// to the MoveTo's cause.
 func (t *CausalTree) DeleteChar() error {
 	if t.Cursor.Timestamp == 0 {
 		return ErrNoAtomToDelete
 	}
+	place := t.Cursor
+	t.Cursor = t.movedAtom(place)
 	if _, err := t.addAtom(Delete{}); err != nil {
+		t.Cursor = place
 		return err
 	}
+	if t.Cursor != place {
+		t.Cursor = t.getAtom(place).Cause
+	}
 	t.fixDeletedCursor()
 	return nil
 }
@@ -971,14 +1168,14 @@ type InsertStr struct{}
 
 func (v InsertStr) AtomPriority() int { return insertStrPriority }
 func (v InsertStr) MarshalJSON() ([]byte, error) {
-	return json.Marshal("insert str container")
+	return []byte(`{"Type":"InsertStr"}`), nil
 }
 
 func (v InsertStr) String() string { return "STR: " }
 
 func (v InsertStr) ValidateChild(child AtomValue) error {
 	switch child.(type) {
-	case InsertChar, Delete:
+	case InsertChar, MoveTo, Tombstone, Delete:
 		return nil
 	default:
 		return fmt.Errorf("invalid atom value after InsertStr: %T (%v)", child, child)
@@ -1005,7 +1202,10 @@ type InsertAdd struct {
 
 func (v InsertAdd) AtomPriority() int { return insertAddPriority }
 func (v InsertAdd) MarshalJSON() ([]byte, error) {
-	return json.Marshal(fmt.Sprintf("insert %d", v.Value))
+	return json.Marshal(struct {
+		Type  string
+		Value int32
+	}{"InsertAdd", v.Value})
 }
 
 func (v InsertAdd) String() string { return strconv.FormatInt(int64(v.Value), 10) }
@@ -1047,7 +1247,7 @@ type InsertCounter struct{}
 
 func (v InsertCounter) AtomPriority() int { return insertCounterPriority }
 func (v InsertCounter) MarshalJSON() ([]byte, error) {
-	return json.Marshal("insert counter container")
+	return []byte(`{"Type":"InsertCounter"}`), nil
 }
 
 func (v InsertCounter) String() string { return "Counter: " }
@@ -1069,13 +1269,387 @@ func (t *CausalTree) InsertCounter() error {
 	return err
 }
 
+// +------------------------------------+
+// | Operations - Insert list container |
+// +------------------------------------+
+
+// InsertList represents a list container, whose children are its elements.
+type InsertList struct{}
+
+func (v InsertList) AtomPriority() int { return insertListPriority }
+func (v InsertList) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"InsertList"}`), nil
+}
+
+func (v InsertList) String() string { return "List: " }
+
+func (v InsertList) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case InsertElem, MoveTo, Tombstone, Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after InsertList: %T (%v)", child, child)
+	}
+}
+
+// +----------------------------------+
+// | Operations - Insert list element |
+// +----------------------------------+
+
+// InsertElem represents an element within a list, inserted after another element or the list's head.
+// Its value is the latest container inserted as its child.
+type InsertElem struct{}
+
+func (v InsertElem) AtomPriority() int { return insertElemPriority }
+func (v InsertElem) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"InsertElem"}`), nil
+}
+
+func (v InsertElem) String() string { return "Elem" }
+
+func (v InsertElem) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case InsertElem, InsertStr, InsertCounter, InsertList, InsertMap, InsertRegister, InsertSet, MoveFrom, MoveTo, Tombstone, Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after InsertElem: %T (%v)", child, child)
+	}
+}
+
+// +-----------------------------------+
+// | Operations - Insert map container |
+// +-----------------------------------+
+
+// InsertMap represents a map container, whose children are key assignments.
+type InsertMap struct{}
+
+func (v InsertMap) AtomPriority() int { return insertMapPriority }
+func (v InsertMap) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"InsertMap"}`), nil
+}
+
+func (v InsertMap) String() string { return "Map: " }
+
+func (v InsertMap) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case InsertKey, Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after InsertMap: %T (%v)", child, child)
+	}
+}
+
+// +-----------------------------+
+// | Operations - Insert map key |
+// +-----------------------------+
+
+// InsertKey represents the assignment of a key within a map. Its value is the latest container
+// inserted as its child.
+//
+// If there are many visible assignments of the same key, the greatest one by AtomID.Compare wins.
+type InsertKey struct {
+	// Key within the map.
+	Key string
+}
+
+func (v InsertKey) AtomPriority() int { return insertKeyPriority }
+func (v InsertKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string
+		Key  string
+	}{"InsertKey", v.Key})
+}
+
+func (v InsertKey) String() string { return "Key: " + strconv.Quote(v.Key) }
+
+func (v InsertKey) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case InsertStr, InsertCounter, InsertList, InsertMap, InsertRegister, InsertSet, Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after InsertKey: %T (%v)", child, child)
+	}
+}
+
+// +----------------------------------------+
+// | Operations - Insert register container |
+// +----------------------------------------+
+
+// InsertRegister represents a last-writer-wins register container, whose children are Set atoms.
+type InsertRegister struct{}
+
+func (v InsertRegister) AtomPriority() int { return insertRegisterPriority }
+func (v InsertRegister) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"InsertRegister"}`), nil
+}
+
+func (v InsertRegister) String() string { return "Register: " }
+
+func (v InsertRegister) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case Set, Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after InsertRegister: %T (%v)", child, child)
+	}
+}
+
+// +---------------------------+
+// | Operations - Set register |
+// +---------------------------+
+
+// Set represents the assignment of a scalar value to a register.
+//
+// If there are many visible assignments in a register, the greatest one by AtomID.Compare wins,
+// that is, the one with the largest timestamp, or from the first site in the sitemap.
+type Set struct {
+	// Scalar value, that is a string, int64, bool or float64.
+	Value interface{}
+}
+
+func (v Set) AtomPriority() int { return setPriority }
+func (v Set) MarshalJSON() ([]byte, error) {
+	payload, err := newJSONScalar(v.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Type string
+		jsonScalar
+	}{"Set", payload})
+}
+
+func (v Set) String() string { return fmt.Sprintf("Set value: %#v", v.Value) }
+
+func (v Set) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after Set: %T (%v)", child, child)
+	}
+}
+
+// Payload of a scalar value in JSON, whose field name depends on the scalar's type.
+type jsonScalar struct {
+	Str   *string  `json:",omitempty"`
+	Int   *int64   `json:",omitempty"`
+	Bool  *bool    `json:",omitempty"`
+	Float *float64 `json:",omitempty"`
+}
+
+func newJSONScalar(x interface{}) (jsonScalar, error) {
+	var payload jsonScalar
+	switch x := x.(type) {
+	case string:
+		payload.Str = &x
+	case int64:
+		payload.Int = &x
+	case bool:
+		payload.Bool = &x
+	case float64:
+		payload.Float = &x
+	default:
+		return payload, fmt.Errorf("%w: %T (%v)", ErrInvalidScalar, x, x)
+	}
+	return payload, nil
+}
+
+// Returns the value converted to one of the scalar types accepted by Set, or an error if it's
+// not convertible.
+func scalarValue(x interface{}) (interface{}, error) {
+	switch v := x.(type) {
+	case string, int64, bool:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			// Not representable in JSON.
+			return nil, fmt.Errorf("%w: %v", ErrInvalidScalar, v)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: %T (%v)", ErrInvalidScalar, x, x)
+}
+
+// +-----------------------------------+
+// | Operations - Insert set container |
+// +-----------------------------------+
+
+// InsertSet represents an observed-remove set container, whose children are its members.
+type InsertSet struct{}
+
+func (v InsertSet) AtomPriority() int { return insertSetPriority }
+func (v InsertSet) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"InsertSet"}`), nil
+}
+
+func (v InsertSet) String() string { return "ORSet: " }
+
+func (v InsertSet) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case InsertMember, Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after InsertSet: %T (%v)", child, child)
+	}
+}
+
+// +--------------------------------+
+// | Operations - Insert set member |
+// +--------------------------------+
+
+// InsertMember represents the addition of a scalar value to a set. The value is a member of the
+// set while some of its InsertMember atoms is not deleted.
+type InsertMember struct {
+	// Scalar value, that is a string, int64, bool or float64.
+	Value interface{}
+}
+
+func (v InsertMember) AtomPriority() int { return insertMemberPriority }
+func (v InsertMember) MarshalJSON() ([]byte, error) {
+	payload, err := newJSONScalar(v.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Type string
+		jsonScalar
+	}{"InsertMember", payload})
+}
+
+func (v InsertMember) String() string { return fmt.Sprintf("Member: %#v", v.Value) }
+
+func (v InsertMember) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after InsertMember: %T (%v)", child, child)
+	}
+}
+
+// +-----------------------+
+// | Operations - Mark text |
+// +-----------------------+
+
+// MarkStart represents the start of a formatting mark, and applies to its cause char.
+//
+// A mark ends at the MarkEnd atom that follows it in its site's yarn, and also applies to the
+// MarkEnd's cause char. If a char is within many marks with the same name, the value of the
+// greatest mark by AtomID.Compare wins.
+type MarkStart struct {
+	// Name of the formatting attribute, e.g., "bold" or "link".
+	Name string
+	// Scalar value of the attribute, or nil to remove it.
+	Value interface{}
+}
+
+func (v MarkStart) AtomPriority() int { return markPriority }
+func (v MarkStart) MarshalJSON() ([]byte, error) {
+	// A nil value has an empty payload.
+	var payload jsonScalar
+	if v.Value != nil {
+		var err error
+		if payload, err = newJSONScalar(v.Value); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(struct {
+		Type string
+		Name string
+		jsonScalar
+	}{"MarkStart", v.Name, payload})
+}
+
+func (v MarkStart) String() string { return fmt.Sprintf("Mark: %s=%#v", v.Name, v.Value) }
+
+func (v MarkStart) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after MarkStart: %T (%v)", child, child)
+	}
+}
+
+// MarkEnd represents the end of the formatting mark that precedes it in its site's yarn.
+type MarkEnd struct{}
+
+func (v MarkEnd) AtomPriority() int { return markPriority }
+func (v MarkEnd) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"MarkEnd"}`), nil
+}
+
+func (v MarkEnd) String() string { return "Mark end" }
+
+func (v MarkEnd) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after MarkEnd: %T (%v)", child, child)
+	}
+}
+
+// +-------------------+
+// | Operations - Move |
+// +-------------------+
+
+// MoveFrom represents the move of its cause, a char or list element, to the position of the MoveTo
+// atom that follows it in its site's yarn. If an atom has many moves, the greatest MoveFrom by
+// AtomID.Compare wins.
+type MoveFrom struct{}
+
+func (v MoveFrom) AtomPriority() int { return movePriority }
+func (v MoveFrom) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"MoveFrom"}`), nil
+}
+
+func (v MoveFrom) String() string { return "Move from" }
+
+func (v MoveFrom) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after MoveFrom: %T (%v)", child, child)
+	}
+}
+
+// MoveTo represents the new position of the atom moved by the MoveFrom that precedes it in its
+// site's yarn. It's placed in a sequence like the chars or elements it stands for, and so they
+// may be inserted after it.
+type MoveTo struct{}
+
+func (v MoveTo) AtomPriority() int { return movePriority }
+func (v MoveTo) MarshalJSON() ([]byte, error) {
+	return []byte(`{"Type":"MoveTo"}`), nil
+}
+
+func (v MoveTo) String() string { return "Move to" }
+
+func (v MoveTo) ValidateChild(child AtomValue) error {
+	switch child.(type) {
+	case InsertChar, InsertElem, MoveTo, Tombstone, Delete:
+		return nil
+	default:
+		return fmt.Errorf("invalid atom value after MoveTo: %T (%v)", child, child)
+	}
+}
+
 // +------------+
 // | Conversion |
 // +------------+
 
 // ToString interprets tree as a sequence of chars.
 func (t *CausalTree) ToString() string {
-	atoms := t.filterDeleted()
+	return atomsToString(t.filterDeleted())
+}
+
+// Represents each visible atom as a char.
+func atomsToString(atoms []Atom) string {
 	chars := make([]rune, len(atoms))
 	for i, atom := range atoms {
 		switch value := atom.Value.(type) {
@@ -1087,6 +1661,22 @@ func (t *CausalTree) ToString() string {
 			chars[i] = '$'
 		case InsertAdd:
 			chars[i] = '0'
+		case InsertList:
+			chars[i] = '['
+		case InsertElem:
+			chars[i] = ','
+		case InsertMap:
+			chars[i] = '{'
+		case InsertKey:
+			chars[i] = ':'
+		case InsertRegister:
+			chars[i] = '='
+		case Set:
+			chars[i] = '.'
+		case InsertSet:
+			chars[i] = '#'
+		case InsertMember:
+			chars[i] = '+'
 		}
 	}
 	return string(chars)
@@ -1106,15 +1696,6 @@ func (t *CausalTree) ToJSON() ([]byte, error) {
 		case InsertChar:
 			elements = append(elements, string(value.Char))
 			i++
-		case InsertStr:
-			strSize := causalBlockSize(atoms[i:]) - 1
-			strChars := make([]rune, strSize)
-
-			for j, atom := range atoms[i+1 : i+strSize+1] {
-				strChars[j] = atom.Value.(InsertChar).Char
-			}
-			elements = append(elements, string(strChars))
-			i = i + strSize + 1
 		case InsertCounter:
 			counterSize := causalBlockSize(atoms[i:]) - 1
 			var counterValue int32 = 0
@@ -1124,6 +1705,9 @@ func (t *CausalTree) ToJSON() ([]byte, error) {
 			}
 			elements = append(elements, counterValue)
 			i = i + counterSize + 1
+		case InsertStr, InsertList, InsertMap, InsertRegister, InsertSet:
+			elements = append(elements, t.snapshotValue(atoms[i].ID))
+			i += causalBlockSize(atoms[i:])
 		default:
 			return nil, fmt.Errorf("ToJSON: type not specified")
 		}
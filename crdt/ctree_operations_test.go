@@ -10,6 +10,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/brunokim/causal-tree/crdt"
@@ -32,6 +34,8 @@ import (
 // merge <local> <remote>            -- merge list 'remote' into list 'local'.
 // check <local> <str>               -- check that the contents of 'local' spell 'str'.
 // checkJSON <local> <str>           -- check that the contents of JSON string 'local' is equivalent to the contents of JSON string 'str'.
+// undo <local>                      -- undo the last operation on list 'local'.
+// redo <local>                      -- redo the last undone operation on list 'local'.
 //
 // Trees are referred by their order of creation, NOT by their sitemap index.
 // The fork operation requires specifying the correct remote index, even if it can be
@@ -54,6 +58,8 @@ const (
 	insertAdd
 	insertAddAt
 	insertCounter
+	undo
+	redo
 )
 
 var numBytes = map[operationType]int{
@@ -98,6 +104,10 @@ func (op operation) String() string {
 		return fmt.Sprintf("merge tree #%d into tree #%d", op.remote, op.local)
 	case insertStr:
 		return fmt.Sprintf("insert str at tree #%d", op.local)
+	case undo:
+		return fmt.Sprintf("undo at tree #%d", op.local)
+	case redo:
+		return fmt.Sprintf("redo at tree #%d", op.local)
 	}
 	return ""
 }
@@ -196,7 +206,7 @@ func testOperations(t *testing.T, ops []operation) []*crdt.CausalTree {
 			must(err)
 			trees = append(trees, remote)
 		case merge:
-			tree.Merge(trees[op.remote])
+			must(tree.Merge(trees[op.remote]))
 		case check:
 			if s := tree.ToString(); s != op.str {
 				t.Errorf("%d: got tree[%d] = %q, want %q", i, op.local, s, op.str)
@@ -210,6 +220,10 @@ func testOperations(t *testing.T, ops []operation) []*crdt.CausalTree {
 			must(tree.InsertAddAt(op.val, op.pos))
 		case insertCounter:
 			must(tree.InsertCounter())
+		case undo:
+			must(tree.Undo())
+		case redo:
+			must(tree.Redo())
 		}
 		// Dump trees into testfile.
 		if f != nil && op.op != check && op.op != checkJSON {
@@ -274,8 +288,8 @@ func validateOperations(ops []operation) error {
 		case merge:
 			if op.remote >= len(trees) {
 				return fmt.Errorf("invalid remote index %d (len: %d), op: %v", op.remote, len(trees), op)
-			} else {
-				tree.Merge(trees[op.remote])
+			} else if err := tree.Merge(trees[op.remote]); err != nil {
+				return fmt.Errorf("%v: %v", op, err)
 			}
 		case insertStr:
 			if err := tree.InsertStr(); err != nil {
@@ -315,6 +329,26 @@ func readFuzzData(filename string) ([]byte, error) {
 
 // -----
 
+// Options to compare trees with cmp.Diff, including their weaves, but ignoring internal caches and buffers.
+var treeOpts = cmp.Options{
+	cmp.Transformer("State", func(t *crdt.CausalTree) treeState {
+		if t == nil {
+			return treeState{}
+		}
+		return treeState{Weave: t.Weave, Horizon: t.Horizon(), Tree: *t}
+	}),
+	cmpopts.IgnoreUnexported(crdt.CausalTree{}),
+	cmpopts.EquateEmpty(),
+}
+
+type treeState struct {
+	Weave   []crdt.Atom
+	Horizon crdt.Weft
+	Tree    crdt.CausalTree
+}
+
+// -----
+
 // Make a tree randomly, using some other sites to make it interesting.
 func makeRandomTree(size int, r *rand.Rand) (*crdt.CausalTree, error) {
 	const numLists = 10
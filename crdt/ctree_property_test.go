@@ -58,6 +58,9 @@ func (m *stateMachine) Check(t *rapid.T) {
 	if got != want {
 		t.Fatalf("content mismatch: want %q but got %q", want, got)
 	}
+	if err := m.t.Validate(); err != nil {
+		t.Fatal(err)
+	}
 	t.Log("content:", got)
 }
 
@@ -1,6 +1,7 @@
 package crdt_test
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -151,6 +152,31 @@ func TestUnknownRemoteYarn(t *testing.T) {
 	})
 }
 
+func TestEditAfterSiteRemap(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000003-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	// Forks are created with smaller UUIDs, so the local atoms are remapped to other sites.
+	testOperations(t, []operation{
+		{op: insertChar, local: 0, char: 'a'},
+		{op: insertChar, local: 0, char: 'b'},
+		{op: fork, local: 0, remote: 1},
+		{op: insertCharAt, local: 0, char: 'c', pos: 0},
+		{op: deleteCharAt, local: 0, pos: 2},
+		{op: checkJSON, local: 0, str: `["a", "c"]`},
+		{op: fork, local: 1, remote: 2},
+		{op: insertCharAt, local: 2, char: 'x', pos: -1},
+		{op: merge, local: 0, remote: 2},
+		{op: insertCharAt, local: 0, char: 'y', pos: 1},
+		{op: deleteCharAt, local: 0, pos: 0},
+		{op: checkJSON, local: 0, str: `["a", "y", "c"]`},
+	})
+}
+
 func TestDeleteCursor(t *testing.T) {
 	teardown := crdt.MockUUIDs(
 		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
@@ -203,6 +229,88 @@ func TestSetCursor(t *testing.T) {
 	})
 }
 
+func TestAtomAtIndexOf(t *testing.T) {
+	tree, err := makeRandomTree(500, newRand())
+	if err != nil {
+		t.Fatalf("makeRandomTree: %v", err)
+	}
+	// Hidden atoms collapse to the position of the closest visible atom before them.
+	numVisible := 0
+	for _, atom := range tree.Weave {
+		i, isVisible := tree.IndexOf(atom.ID)
+		if isVisible {
+			if i != numVisible {
+				t.Fatalf("IndexOf(%v): got %d, want %d", atom.ID, i, numVisible)
+			}
+			if id, err := tree.AtomAt(i); err != nil || id != atom.ID {
+				t.Fatalf("AtomAt(%d): got (%v, %v), want %v", i, id, err, atom.ID)
+			}
+			numVisible++
+		} else if i != numVisible-1 {
+			t.Fatalf("IndexOf(%v) (hidden): got %d, want %d", atom.ID, i, numVisible-1)
+		}
+	}
+	if numVisible != len([]rune(tree.ToString())) {
+		t.Errorf("got %d visible atoms, want %d", numVisible, len([]rune(tree.ToString())))
+	}
+	if i, isVisible := tree.IndexOf(crdt.AtomID{}); i != -1 || !isVisible {
+		t.Errorf("IndexOf(root): got (%d, %t), want (-1, true)", i, isVisible)
+	}
+	if i, isVisible := tree.IndexOf(crdt.AtomID{Site: 0, Index: 9999, Timestamp: 9999}); i != -1 || isVisible {
+		t.Errorf("IndexOf(unknown): got (%d, %t), want (-1, false)", i, isVisible)
+	}
+	for _, i := range []int{-1, numVisible} {
+		if _, err := tree.AtomAt(i); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+			t.Errorf("AtomAt(%d): got %v, want %v", i, err, crdt.ErrCursorOutOfRange)
+		}
+	}
+}
+
+func TestIndexOfAfterMerge(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := testOperations(t, []operation{
+		{op: insertChar, local: 0, char: 'a'},
+		{op: insertChar, local: 0, char: 'b'},
+		{op: insertChar, local: 0, char: 'c'},
+		{op: insertChar, local: 0, char: 'd'},
+		{op: fork, local: 0, remote: 1},
+	})
+	t0, t1 := trees[0], trees[1]
+	bookmark, err := t0.AtomAt(2)
+	if err != nil {
+		t.Fatalf("AtomAt: %v", err)
+	}
+	steps := []func() error{
+		func() error { return t1.InsertCharAt('x', -1) },
+		func() error { return t1.InsertCharAt('y', 1) },
+		func() error { return t0.Merge(t1) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+	}
+	// xaybcd
+	if i, isVisible := t0.IndexOf(bookmark); i != 4 || !isVisible {
+		t.Errorf("got (%d, %t), want (4, true)", i, isVisible)
+	}
+	if err := t1.DeleteCharAt(4); err != nil {
+		t.Fatalf("DeleteCharAt: %v", err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	// xaybd
+	if i, isVisible := t0.IndexOf(bookmark); i != 3 || isVisible {
+		t.Errorf("got (%d, %t), want (3, false)", i, isVisible)
+	}
+}
+
 func TestDeleteAfterMerge(t *testing.T) {
 	teardown := crdt.MockUUIDs(
 		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
@@ -269,6 +377,88 @@ func TestInsertsAtSamePosition(t *testing.T) {
 	})
 }
 
+// Sites make random concurrent edits, moves and merges, and must converge after merging with each other.
+func TestMergeConvergence(t *testing.T) {
+	const numSites, numSteps = 3, 60
+	for seed := int64(0); seed < 300; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		t0 := crdt.NewCausalTree()
+		trees := []*crdt.CausalTree{t0}
+		for len(trees) < numSites {
+			tree, err := t0.Fork()
+			if err != nil {
+				t.Fatal(err)
+			}
+			trees = append(trees, tree)
+		}
+		merge := func(i, j int) {
+			if err := trees[i].Merge(trees[j]); err != nil {
+				t.Fatalf("seed %d: merge %d <- %d: %v", seed, i, j, err)
+			}
+			if err := trees[i].Validate(); err != nil {
+				t.Fatalf("seed %d: merge %d <- %d: %v", seed, i, j, err)
+			}
+		}
+		for step := 0; step < numSteps; step++ {
+			tree := trees[r.Intn(numSites)]
+			n := len(tree.ToString())
+			var err error
+			switch op := r.Intn(10); {
+			case op == 0 && n > 0:
+				err = tree.DeleteCharAt(r.Intn(n))
+			case op == 1 && n > 0:
+				from := r.Intn(n)
+				err = tree.DeleteRange(from, from+r.Intn(n-from)+1)
+			case op == 2:
+				err = tree.InsertString("xyz"[:r.Intn(3)+1], r.Intn(n+1)-1)
+			case op == 3:
+				if err = tree.Undo(); errors.Is(err, crdt.ErrNothingToUndo) {
+					err = nil
+				}
+			case op == 4:
+				if err = tree.Redo(); errors.Is(err, crdt.ErrNothingToRedo) {
+					err = nil
+				}
+			case op == 5:
+				merge(r.Intn(numSites), r.Intn(numSites))
+			case op == 7 && n > 0:
+				from := r.Intn(n)
+				to := from + r.Intn(n-from) + 1
+				if err = tree.Move(from, to, r.Intn(n+1)-1); errors.Is(err, crdt.ErrInvalidMove) {
+					err = nil
+				}
+			case op == 6:
+				// Sync with a delta of all atoms, of which the tree skips the ones it has.
+				remote := trees[r.Intn(numSites)]
+				var delta *crdt.Delta
+				if delta, err = remote.DeltaSince(make(crdt.Weft, len(remote.Sitemap))); err == nil {
+					err = tree.ApplyDelta(delta)
+				}
+				if err == nil {
+					err = tree.Validate()
+				}
+			default:
+				err = tree.InsertCharAt(rune('a'+r.Intn(26)), r.Intn(n+1)-1)
+			}
+			if err != nil {
+				t.Fatalf("seed %d: step #%d: %v", seed, step, err)
+			}
+		}
+		for k := 0; k < 2; k++ {
+			for i := range trees {
+				for j := range trees {
+					merge(i, j)
+				}
+			}
+		}
+		for i, tree := range trees[1:] {
+			if got, want := tree.ToString(), t0.ToString(); got != want {
+				t.Fatalf("seed %d: site #%d: got %q, want %q", seed, i+1, got, want)
+			}
+		}
+	}
+}
+
 // -----
 
 func setupTestView(t *testing.T) []*crdt.CausalTree {
@@ -748,6 +938,25 @@ func BenchmarkInsertChar(b *testing.B) {
 	}
 }
 
+// Measures insertions alone, without cloning the tree, by inserting repeatedly in the middle
+// of the same tree.
+func BenchmarkInsertCharInPlace(b *testing.B) {
+	for _, size := range sizes {
+		tree := getBenchTree(size)
+		name := fmt.Sprintf("size=%d", size)
+		b.Run(name, func(b *testing.B) {
+			t1 := tree.Clone()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				t1.SetCursor(size / 2)
+				if err := t1.InsertChar('x'); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkDeleteChar(b *testing.B) {
 	for _, size := range sizes {
 		tree := getBenchTree(size)
@@ -0,0 +1,134 @@
+package crdt
+
+// +----------------+
+// | Cursor handles |
+// +----------------+
+
+// Cursor is a position within a tree that is independent from the tree's own Cursor, so that
+// multiple editors may operate on the same replica.
+//
+// Like the tree's Cursor, it holds the ID of the causing atom for the next operation, and it's
+// moved to the closest non-deleted ancestor whenever its atom is deleted, either locally or by
+// a merge.
+type Cursor struct {
+	tree   *CausalTree
+	atomID AtomID
+}
+
+// NewCursor creates a cursor handle at the same position as the tree's cursor.
+//
+// The handle is updated by the tree until it's closed.
+func (t *CausalTree) NewCursor() *Cursor {
+	c := &Cursor{tree: t, atomID: t.Cursor}
+	t.cursors = append(t.cursors, c)
+	return c
+}
+
+// Close stops updating the cursor. It shouldn't be used afterwards.
+//
+// Time complexity: O(cursors)
+func (c *Cursor) Close() {
+	cursors := c.tree.cursors
+	for i, other := range cursors {
+		if other == c {
+			copy(cursors[i:], cursors[i+1:])
+			cursors[len(cursors)-1] = nil
+			c.tree.cursors = cursors[:len(cursors)-1]
+			return
+		}
+	}
+}
+
+// Moves the cursor handles to the same atoms in another tree that will replace this one,
+// identifying them by site UUID and yarn index. Handles whose atom is not present are moved to
+// the root.
+//
+// Time complexity: O(cursors * log(sites))
+func (t *CausalTree) rebindCursors(other *CausalTree) {
+	for _, c := range t.cursors {
+		atomID, ok := other.localAtomID(t.siteAtomID(c.atomID))
+		if atom, found := other.lookupAtom(atomID.yarnPosition()); !ok || !found || atom.ID != atomID || isCompacted(atom) {
+			atomID = AtomID{}
+		}
+		c.atomID = atomID
+	}
+	other.cursors = t.cursors
+}
+
+// ID returns the ID of the causing atom for the next operation.
+func (c *Cursor) ID() AtomID {
+	return c.atomID
+}
+
+// Executes a tree operation using this cursor, instead of the tree's own.
+func (c *Cursor) do(op func() error) error {
+	t := c.tree
+	cursor := t.Cursor
+	t.Cursor = c.atomID
+	err := op()
+	c.atomID = t.Cursor
+	t.Cursor = cursor
+	t.fixDeletedCursor()
+	return err
+}
+
+// Set sets the cursor to the given (tree) position. See CausalTree.SetCursor.
+func (c *Cursor) Set(i int) error {
+	return c.do(func() error { return c.tree.SetCursor(i) })
+}
+
+// InsertChar inserts a char after the cursor position and advances the cursor.
+func (c *Cursor) InsertChar(ch rune) error {
+	return c.do(func() error { return c.tree.InsertChar(ch) })
+}
+
+// InsertCharAt inserts a char after the given (tree) position.
+func (c *Cursor) InsertCharAt(ch rune, i int) error {
+	return c.do(func() error { return c.tree.InsertCharAt(ch, i) })
+}
+
+// DeleteChar deletes the char at the cursor position, and relocates the cursor to its cause.
+func (c *Cursor) DeleteChar() error {
+	return c.do(func() error { return c.tree.DeleteChar() })
+}
+
+// DeleteCharAt deletes the char at the given (tree) position.
+func (c *Cursor) DeleteCharAt(i int) error {
+	return c.do(func() error { return c.tree.DeleteCharAt(i) })
+}
+
+// InsertStr inserts a Str container after the root and advances the cursor.
+func (c *Cursor) InsertStr() error {
+	return c.do(func() error { return c.tree.InsertStr() })
+}
+
+// InsertAdd inserts an InsertAdd atom after the cursor position and advances the cursor.
+func (c *Cursor) InsertAdd(val int32) error {
+	return c.do(func() error { return c.tree.InsertAdd(val) })
+}
+
+// InsertAddAt inserts an InsertAdd atom after the given (tree) position.
+func (c *Cursor) InsertAddAt(val int32, i int) error {
+	return c.do(func() error { return c.tree.InsertAddAt(val, i) })
+}
+
+// InsertCounter inserts a Counter container after the root and advances the cursor.
+func (c *Cursor) InsertCounter() error {
+	return c.do(func() error { return c.tree.InsertCounter() })
+}
+
+// InsertString inserts a string after the given (tree) position. See CausalTree.InsertString.
+func (c *Cursor) InsertString(s string, at int) error {
+	return c.do(func() error { return c.tree.InsertString(s, at) })
+}
+
+// DeleteRange deletes atoms from the (tree) positions in the range [from, to). See CausalTree.DeleteRange.
+func (c *Cursor) DeleteRange(from, to int) error {
+	return c.do(func() error { return c.tree.DeleteRange(from, to) })
+}
+
+// ReplaceRange replaces atoms from the (tree) positions in the range [from, to) with a string.
+// See CausalTree.ReplaceRange.
+func (c *Cursor) ReplaceRange(from, to int, s string) error {
+	return c.do(func() error { return c.tree.ReplaceRange(from, to, s) })
+}
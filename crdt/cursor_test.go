@@ -0,0 +1,134 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/uuid"
+)
+
+func TestCursors(t *testing.T) {
+	// Forked site is placed before the local one in the sitemap, remapping local atoms.
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	tree := crdt.NewCausalTree()
+	c1, c2 := tree.NewCursor(), tree.NewCursor()
+	remote := new(crdt.CausalTree)
+	steps := []struct {
+		f    func() error
+		want string
+	}{
+		{func() error { return tree.InsertChar('a') }, "a"},
+		{func() error { return tree.InsertChar('b') }, "ab"},
+		{func() error { return tree.InsertChar('c') }, "abc"},
+		{func() error { return c1.Set(0) }, "abc"},
+		{func() error { return c2.Set(2) }, "abc"},
+		// Cursors operate independently.
+		{func() error { return c1.InsertChar('x') }, "axbc"},
+		{func() error { return c2.InsertChar('y') }, "axbcy"},
+		{func() error { return c1.InsertChar('z') }, "axzbcy"},
+		{func() error { return tree.InsertChar('d') }, "axzbcdy"},
+		// Cursors are repaired on local delete.
+		{func() error { return tree.DeleteCharAt(2) }, "axbcdy"},
+		{func() error { return c1.InsertChar('w') }, "axwbcdy"},
+		{func() error { return c1.DeleteChar() }, "axbcdy"},
+		{func() error { return c1.DeleteChar() }, "abcdy"},
+		{func() error { return tree.InsertChar('e') }, "aebcdy"},
+		// Cursors are repaired on remap and merge.
+		{func() (err error) { remote, err = tree.Fork(); return err }, "aebcdy"},
+		{func() error { return remote.DeleteCharAt(5) }, "aebcdy"},
+		{func() error { return tree.Merge(remote) }, "aebcd"},
+		{func() error { return c2.InsertChar('!') }, "aebc!d"},
+		{func() error { return c1.InsertChar('?') }, "a?ebc!d"},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if s := tree.ToString(); s != step.want {
+			t.Fatalf("step #%d: got %q, want %q", i, s, step.want)
+		}
+	}
+	// Closed cursors are not updated.
+	c2.Close()
+	id := c2.ID()
+	if err := tree.DeleteCharAt(5); err != nil {
+		t.Fatalf("DeleteCharAt: %v", err)
+	}
+	if c2.ID() != id {
+		t.Errorf("closed cursor moved from %v to %v", id, c2.ID())
+	}
+}
+
+func TestCursorsDecode(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		testCursorsDecode(t,
+			func(tree *crdt.CausalTree) ([]byte, error) { return json.Marshal(tree) },
+			func(tree *crdt.CausalTree, data []byte) error { return json.Unmarshal(data, tree) })
+	})
+	t.Run("binary", func(t *testing.T) {
+		testCursorsDecode(t,
+			func(tree *crdt.CausalTree) ([]byte, error) { return tree.MarshalBinary() },
+			func(tree *crdt.CausalTree, data []byte) error { return tree.UnmarshalBinary(data) })
+	})
+}
+
+func testCursorsDecode(t *testing.T, encode func(*crdt.CausalTree) ([]byte, error), decode func(*crdt.CausalTree, []byte) error) {
+	// Forked site is placed before the local one in the sitemap, remapping local atoms.
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	tree := crdt.NewCausalTree()
+	c1 := tree.NewCursor()
+	var c2 *crdt.Cursor
+	steps := []struct {
+		f    func() error
+		want string
+	}{
+		{func() error { return tree.InsertString("abc", -1) }, "abc"},
+		{func() error { return c1.Set(1) }, "abc"},
+		{func() error {
+			remote, err := tree.Fork()
+			if err != nil {
+				return err
+			}
+			if err := remote.InsertCharAt('x', -1); err != nil {
+				return err
+			}
+			if err := tree.InsertCharAt('z', 2); err != nil {
+				return err
+			}
+			c2 = tree.NewCursor()
+			data, err := encode(remote)
+			if err != nil {
+				return err
+			}
+			return decode(tree, data)
+		}, "xabc"},
+		// Handles are kept on atoms present in the decoded tree, and moved to the root otherwise.
+		{func() error { return c1.InsertChar('!') }, "xab!c"},
+		{func() error { return c2.InsertChar('?') }, "?xab!c"},
+		// Handles are still updated by the tree.
+		{func() error { return tree.DeleteCharAt(4) }, "?xabc"},
+		{func() error { return c1.InsertChar('-') }, "?xab-c"},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if s := tree.ToString(); s != step.want {
+			t.Fatalf("step #%d: got %q, want %q", i, s, step.want)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,147 @@
+package crdt
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// +------------+
+// | Delta sync |
+// +------------+
+
+// Delta contains the atoms of a tree that were created after a given weft.
+//
+// It can be applied to any tree that has seen all atoms up to that weft, transferring only
+// the atoms it may be missing, instead of the whole remote tree as in Merge.
+type Delta struct {
+	// Sitemap is the sitemap of the originating tree, which is used by atoms in this delta.
+	Sitemap []uuid.UUID
+	// Yarns contains the suffix of each site's yarn past the weft.
+	Yarns [][]Atom
+	// Timestamp is the originating tree's Lamport timestamp.
+	Timestamp uint32
+}
+
+// Errors returned by delta operations.
+var (
+	ErrDeltaDisconnected = errors.New("delta has atoms whose predecessors are not in tree")
+)
+
+// DeltaSince returns the atoms created after the provided weft, which uses this tree's site indices.
+//
+// Time complexity: O(sites*log(atoms) + delta atoms)
+func (t *CausalTree) DeltaSince(weft Weft) (*Delta, error) {
+	if len(weft) != len(t.Yarns) {
+		return nil, ErrWeftInvalidLength
+	}
+	if t.isBehindHorizon(weft) {
+		return nil, ErrWeftCompacted
+	}
+	n := len(t.Sitemap)
+	delta := &Delta{
+		Sitemap:   make([]uuid.UUID, n),
+		Yarns:     make([][]Atom, n),
+		Timestamp: t.Timestamp,
+	}
+	copy(delta.Sitemap, t.Sitemap)
+	for i, yarn := range t.Yarns {
+		// Timestamps within a yarn are increasing.
+		tmax := weft[i]
+		start := sort.Search(len(yarn), func(j int) bool {
+			return yarn[j].ID.Timestamp > tmax
+		})
+		delta.Yarns[i] = make([]Atom, len(yarn)-start)
+		copy(delta.Yarns[i], yarn[start:])
+	}
+	return delta, nil
+}
+
+// Len returns the number of atoms in delta.
+func (d *Delta) Len() int {
+	var n int
+	for _, yarn := range d.Yarns {
+		n += len(yarn)
+	}
+	return n
+}
+
+// Returns the delta's atoms, remapped to local sites, sorted in causal order.
+// Atoms already present in the tree are skipped.
+//
+// Time complexity: O(atoms*log(atoms))
+func (t *CausalTree) deltaAtoms(d *Delta, remap indexMap) ([]Atom, error) {
+	var atoms []Atom
+	for _, yarn := range d.Yarns {
+		for _, atom := range yarn {
+			atom = atom.remapSite(remap)
+			if int(atom.ID.Index) < len(t.Yarns[atom.ID.Site]) {
+				// Atom is already present.
+				continue
+			}
+			if isCompacted(atom) || isTombstone(atom) {
+				return nil, ErrMergeCompacted
+			}
+			atoms = append(atoms, atom)
+		}
+	}
+	// An atom always has a larger timestamp than its cause.
+	sort.Slice(atoms, func(i, j int) bool {
+		return atoms[i].ID.Compare(atoms[j].ID) < 0
+	})
+	// Check that each atom has its cause and yarn predecessor, either in the tree or in the delta.
+	sizes := make([]int, len(t.Yarns))
+	for i, yarn := range t.Yarns {
+		sizes[i] = len(yarn)
+	}
+	for _, atom := range atoms {
+		id, cause := atom.ID, atom.Cause
+		if int(id.Index) != sizes[id.Site] {
+			return nil, ErrDeltaDisconnected
+		}
+		if cause.Timestamp > 0 && int(cause.Index) >= sizes[cause.Site] {
+			return nil, ErrDeltaDisconnected
+		}
+		sizes[id.Site]++
+	}
+	return atoms, nil
+}
+
+// ApplyDelta integrates the delta's atoms into this tree, as if merging with the originating tree.
+// It returns an error if the tree is missing atoms that were not included in the delta, or if the
+// delta includes atoms removed by a compaction, in which case the tree is not modified.
+//
+// Time complexity: O((delta atoms) * (log(atoms) + avg. block size) + sites*log(sites))
+func (t *CausalTree) ApplyDelta(d *Delta) error {
+	if len(d.Yarns) != len(d.Sitemap) {
+		return ErrDeltaDisconnected
+	}
+	// Check delta against a merged sitemap before modifying the tree.
+	sitemap := mergeSitemaps(t.Sitemap, d.Sitemap)
+	view := &CausalTree{Yarns: make([][]Atom, len(sitemap))}
+	for i, yarn := range t.Yarns {
+		view.Yarns[siteIndex(sitemap, t.Sitemap[i])] = yarn
+	}
+	remap := make(indexMap)
+	for i, site := range d.Sitemap {
+		remap.set(i, siteIndex(sitemap, site))
+	}
+	atoms, err := view.deltaAtoms(d, remap)
+	if err != nil {
+		return err
+	}
+	// Integrate atoms one by one.
+	t.mergeSitemap(d.Sitemap)
+	for _, atom := range atoms {
+		t.insertRemoteAtom(atom)
+		t.Yarns[atom.ID.Site] = append(t.Yarns[atom.ID.Site], atom)
+	}
+	if t.Timestamp < d.Timestamp {
+		t.Timestamp = d.Timestamp
+	}
+	t.Timestamp++
+	t.fixDeletedCursor()
+	t.flushPending()
+	return nil
+}
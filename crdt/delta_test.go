@@ -0,0 +1,145 @@
+package crdt_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestApplyDelta(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000003-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := testOperations(t, []operation{
+		{op: insertChar, local: 0, char: 'a'},
+		{op: insertChar, local: 0, char: 'b'},
+		{op: insertChar, local: 0, char: 'c'},
+		{op: fork, local: 0, remote: 1},
+		{op: fork, local: 1, remote: 2},
+		// Site #1: abc -> abXc
+		{op: insertCharAt, local: 1, char: 'X', pos: 1},
+		// Site #2: abc -> ab, unknown to site #0.
+		{op: deleteCharAt, local: 2, pos: 2},
+		{op: merge, local: 1, remote: 2},
+		// Site #0: abc -> abcd
+		{op: insertChar, local: 0, char: 'd'},
+		{op: check, local: 0, str: "abcd"},
+		{op: check, local: 1, str: "abX"},
+	})
+	t0, t1 := trees[0], trees[1]
+	// Site #1 knows what site #0 had when it was forked.
+	weft := crdt.Weft{t1.Yarns[0][2].ID.Timestamp, 0, 0}
+	delta, err := t1.DeltaSince(weft)
+	if err != nil {
+		t.Fatalf("DeltaSince: %v", err)
+	}
+	if delta.Len() != 2 {
+		t.Errorf("delta.Len() = %d, want 2", delta.Len())
+	}
+
+	want := t0.Clone()
+	want.Merge(t1)
+	if err := t0.ApplyDelta(delta); err != nil {
+		t.Fatalf("ApplyDelta: %v", err)
+	}
+	if diff := cmp.Diff(want, t0, treeOpts); diff != "" {
+		t.Errorf("ApplyDelta (-want, +got):\n%s", diff)
+	}
+	if s := t0.ToString(); s != "abXd" {
+		t.Errorf("got %q, want %q", s, "abXd")
+	}
+	// Applying the same delta is a no-op, besides incrementing the clock.
+	if err := t0.ApplyDelta(delta); err != nil {
+		t.Fatalf("ApplyDelta (again): %v", err)
+	}
+	want.Timestamp++
+	if diff := cmp.Diff(want, t0, treeOpts); diff != "" {
+		t.Errorf("ApplyDelta (again) (-want, +got):\n%s", diff)
+	}
+}
+
+func TestApplyDeltaError(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := testOperations(t, []operation{
+		{op: insertChar, local: 0, char: 'a'},
+		{op: fork, local: 0, remote: 1},
+		{op: insertChar, local: 1, char: 'b'},
+		{op: insertChar, local: 1, char: 'c'},
+	})
+	t0, t1 := trees[0], trees[1]
+	// Delta skips 'b', that is not present in site #0.
+	bTime := t1.Yarns[1][0].ID.Timestamp
+	delta, err := t1.DeltaSince(crdt.Weft{t1.Now()[0], bTime})
+	if err != nil {
+		t.Fatalf("DeltaSince: %v", err)
+	}
+	want := t0.Clone()
+	if err := t0.ApplyDelta(delta); !errors.Is(err, crdt.ErrDeltaDisconnected) {
+		t.Errorf("ApplyDelta: got %v, want %v", err, crdt.ErrDeltaDisconnected)
+	}
+	if diff := cmp.Diff(want, t0, treeOpts); diff != "" {
+		t.Errorf("tree changed after error (-want, +got):\n%s", diff)
+	}
+	if _, err := t1.DeltaSince(crdt.Weft{0}); !errors.Is(err, crdt.ErrWeftInvalidLength) {
+		t.Errorf("DeltaSince: got %v, want %v", err, crdt.ErrWeftInvalidLength)
+	}
+}
+
+func TestApplyDeltaRandom(t *testing.T) {
+	r := newRand()
+	base, err := makeRandomTree(200, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, _ := base.Fork()
+	weft := base.Now()
+	local := base.Clone()
+	// Diverge both trees, making remote aware of new sites.
+	for i := 0; i < 50; i++ {
+		local.InsertCharAt('x', r.Intn(len(local.ToString())+1)-1)
+	}
+	fork, _ := remote.Fork()
+	for i := 0; i < 50; i++ {
+		fork.InsertCharAt('y', r.Intn(len(fork.ToString())+1)-1)
+		if n := len(remote.ToString()); n > 0 {
+			remote.DeleteCharAt(r.Intn(n))
+		}
+	}
+	remote.Merge(fork)
+	// Translate base's weft to remote's site indices.
+	remoteWeft := make(crdt.Weft, len(remote.Sitemap))
+	for i, site := range remote.Sitemap {
+		for j, other := range base.Sitemap {
+			if other == site {
+				remoteWeft[i] = weft[j]
+			}
+		}
+	}
+	delta, err := remote.DeltaSince(remoteWeft)
+	if err != nil {
+		t.Fatalf("DeltaSince: %v", err)
+	}
+	want := local.Clone()
+	want.Merge(remote)
+	if err := local.ApplyDelta(delta); err != nil {
+		t.Fatalf("ApplyDelta: %v", err)
+	}
+	if diff := cmp.Diff(want.Weave, local.Weave); diff != "" {
+		t.Errorf("weave (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want.Yarns, local.Yarns); diff != "" {
+		t.Errorf("yarns (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,218 @@
+package crdt
+
+import (
+	"fmt"
+)
+
+// +-----------------------+
+// | Atom-at-a-time merges |
+// +-----------------------+
+
+// Position of an atom within the yarns, which identifies it without its timestamp.
+type yarnPosition struct {
+	site  uint16
+	index uint32
+}
+
+func (id AtomID) yarnPosition() yarnPosition {
+	return yarnPosition{id.Site, id.Index}
+}
+
+// Integrate inserts remote atoms into the tree, in any order.
+//
+// Atoms must refer to sites using this tree's site indices. An atom whose cause, or whose
+// predecessor in its yarn, is not yet present is held in a pending buffer, and is integrated
+// as soon as the missing atom arrives, either by another call to Integrate or a merge.
+// Atoms already present in the tree are dropped. Atoms whose cause was removed by Compact are
+// rejected.
+//
+// Atoms are checked against their cause and yarn predecessor, if they're present in the tree or
+// in the same call: the cause must have the same ID, and accept the atom's value as a child, and
+// timestamps must increase within a yarn. A pending atom that fails these checks when its missing
+// dependency arrives is dropped.
+//
+// Time complexity: O((new atoms) * (log(atoms) + avg. block size))
+func (t *CausalTree) Integrate(atoms ...Atom) error {
+	if err := t.checkIntegrate(atoms, len(t.Yarns)); err != nil {
+		return err
+	}
+	for _, atom := range atoms {
+		t.integrate(atom)
+	}
+	t.fixDeletedCursor()
+	return nil
+}
+
+// Checks atoms before integrating them, as described in Integrate. Site indices up to numSites
+// are accepted, and sites beyond this tree's sitemap are considered to be empty.
+//
+// Time complexity: O(new atoms)
+func (t *CausalTree) checkIntegrate(atoms []Atom, numSites int) error {
+	batch := make(map[yarnPosition]Atom, len(atoms))
+	for _, atom := range atoms {
+		if int(atom.ID.Site) >= numSites || int(atom.Cause.Site) >= numSites {
+			return ErrUnknownSite
+		}
+		if atom.ID.Timestamp <= atom.Cause.Timestamp || isCompacted(atom) || isTombstone(atom) {
+			return ErrInvalidAtom
+		}
+		batch[atom.ID.yarnPosition()] = atom
+	}
+	lookup := func(pos yarnPosition) (Atom, bool) {
+		if int(pos.site) < len(t.Yarns) {
+			if atom, ok := t.lookupAtom(pos); ok {
+				return atom, true
+			}
+		}
+		atom, ok := batch[pos]
+		return atom, ok
+	}
+	for _, atom := range atoms {
+		if err := checkDependencies(atom, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks an atom against its cause and yarn predecessor, if they can be found, and against an
+// atom with the same position.
+func checkDependencies(atom Atom, lookup func(yarnPosition) (Atom, bool)) error {
+	pos := atom.ID.yarnPosition()
+	if other, ok := lookup(pos); ok && other.ID != atom.ID {
+		return fmt.Errorf("%w: atom %v conflicts with %v", ErrInvalidAtom, atom.ID, other.ID)
+	}
+	if pos.index > 0 {
+		prev, ok := lookup(yarnPosition{pos.site, pos.index - 1})
+		if ok && prev.ID.Timestamp >= atom.ID.Timestamp {
+			return fmt.Errorf("%w: atom %v doesn't have a larger timestamp than its predecessor %v", ErrInvalidAtom, atom.ID, prev.ID)
+		}
+	}
+	if atom.Cause.Timestamp == 0 {
+		return nil
+	}
+	cause, ok := lookup(atom.Cause.yarnPosition())
+	if !ok {
+		return nil
+	}
+	if cause.ID != atom.Cause {
+		return fmt.Errorf("%w: atom %v has cause %v, found %v", ErrInvalidAtom, atom.ID, atom.Cause, cause.ID)
+	}
+	if isCompacted(cause) {
+		// Cause was removed by Compact.
+		return ErrMergeCompacted
+	}
+	if err := cause.Value.ValidateChild(atom.Value); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAtom, err)
+	}
+	return nil
+}
+
+// Pending returns the atoms waiting for their causes to be integrated.
+func (t *CausalTree) Pending() []Atom {
+	var atoms []Atom
+	for _, waiting := range t.pending {
+		atoms = append(atoms, waiting...)
+	}
+	return atoms
+}
+
+// Returns whether the atom at the given position is present in the tree.
+func (t *CausalTree) hasAtom(pos yarnPosition) bool {
+	return int(pos.index) < len(t.Yarns[pos.site])
+}
+
+// Returns the atom at the given position, if it's present in the tree.
+func (t *CausalTree) lookupAtom(pos yarnPosition) (Atom, bool) {
+	if !t.hasAtom(pos) {
+		return Atom{}, false
+	}
+	return t.Yarns[pos.site][pos.index], true
+}
+
+// Integrates a single atom, or buffers it if it's missing a dependency. Then, integrates all
+// atoms that were waiting for it.
+func (t *CausalTree) integrate(atom Atom) {
+	queue := []Atom{atom}
+	for len(queue) > 0 {
+		atom := queue[0]
+		queue = queue[1:]
+		pos := atom.ID.yarnPosition()
+		if t.hasAtom(pos) {
+			// Drop duplicate.
+			continue
+		}
+		// Buffer atom if it's missing a dependency.
+		var deps []yarnPosition
+		if pos.index > 0 {
+			deps = append(deps, yarnPosition{pos.site, pos.index - 1})
+		}
+		if atom.Cause.Timestamp > 0 {
+			deps = append(deps, atom.Cause.yarnPosition())
+		}
+		var isMissing bool
+		for _, dep := range deps {
+			if !t.hasAtom(dep) {
+				t.addPending(dep, atom)
+				isMissing = true
+				break
+			}
+		}
+		if isMissing {
+			continue
+		}
+		if err := checkDependencies(atom, t.lookupAtom); err != nil {
+			// Drop atom that can't be integrated, along with the atoms waiting for it.
+			continue
+		}
+		// Insert atom and release all atoms waiting for it.
+		t.insertRemoteAtom(atom)
+		t.Yarns[pos.site] = append(t.Yarns[pos.site], atom)
+		if t.Timestamp < atom.ID.Timestamp {
+			t.Timestamp = atom.ID.Timestamp
+		}
+		queue = append(queue, t.pending[pos]...)
+		delete(t.pending, pos)
+	}
+}
+
+func (t *CausalTree) addPending(dep yarnPosition, atom Atom) {
+	if t.pending == nil {
+		t.pending = make(map[yarnPosition][]Atom)
+	}
+	for _, other := range t.pending[dep] {
+		if other.ID == atom.ID {
+			// Drop duplicate.
+			return
+		}
+	}
+	t.pending[dep] = append(t.pending[dep], atom)
+}
+
+// Tries to integrate all pending atoms, e.g., after a merge.
+func (t *CausalTree) flushPending() {
+	if len(t.pending) == 0 {
+		return
+	}
+	atoms := t.Pending()
+	t.pending = nil
+	for _, atom := range atoms {
+		t.integrate(atom)
+	}
+}
+
+// Time complexity: O(pending atoms)
+func (t *CausalTree) remapPending(m indexMap) {
+	if len(t.pending) == 0 {
+		return
+	}
+	pending := make(map[yarnPosition][]Atom, len(t.pending))
+	for dep, atoms := range t.pending {
+		dep.site = uint16(m.get(int(dep.site)))
+		for i, atom := range atoms {
+			atoms[i] = atom.remapSite(m)
+		}
+		pending[dep] = atoms
+	}
+	t.pending = pending
+}
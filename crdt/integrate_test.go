@@ -0,0 +1,175 @@
+package crdt_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestIntegrate(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := testOperations(t, []operation{
+		{op: insertChar, local: 0, char: 'a'},
+		{op: insertChar, local: 0, char: 'b'},
+		{op: fork, local: 0, remote: 1},
+		// Site #1: ab -> xaby -> xab
+		{op: insertCharAt, local: 1, char: 'x', pos: -1},
+		{op: insertCharAt, local: 1, char: 'y', pos: 2},
+		{op: deleteCharAt, local: 1, pos: 3},
+		// Site #0: ab -> abc
+		{op: insertChar, local: 0, char: 'c'},
+	})
+	t0, t1 := trees[0], trees[1]
+	want := t0.Clone()
+	want.Merge(t1)
+
+	// Deliver atoms from site #1 in reverse order: y-delete, y, x.
+	atoms := t1.Yarns[1]
+	if err := t0.Integrate(atoms[2]); err != nil {
+		t.Fatalf("Integrate(%v): %v", atoms[2], err)
+	}
+	if err := t0.Integrate(atoms[1]); err != nil {
+		t.Fatalf("Integrate(%v): %v", atoms[1], err)
+	}
+	if got := len(t0.Pending()); got != 2 {
+		t.Errorf("len(Pending()) = %d, want 2", got)
+	}
+	if s := t0.ToString(); s != "abc" {
+		t.Errorf("got %q, want %q", s, "abc")
+	}
+	// Deliver x, releasing all other atoms, and some duplicates.
+	if err := t0.Integrate(atoms[0], atoms[1], atoms[0]); err != nil {
+		t.Fatalf("Integrate(%v): %v", atoms[0], err)
+	}
+	if got := len(t0.Pending()); got != 0 {
+		t.Errorf("len(Pending()) = %d, want 0", got)
+	}
+	if s := t0.ToString(); s != "xabc" {
+		t.Errorf("got %q, want %q", s, "xabc")
+	}
+	if diff := cmp.Diff(want.Weave, t0.Weave); diff != "" {
+		t.Errorf("weave (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want.Yarns, t0.Yarns); diff != "" {
+		t.Errorf("yarns (-want, +got):\n%s", diff)
+	}
+}
+
+func TestIntegratePendingMerge(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000000-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := testOperations(t, []operation{
+		{op: fork, local: 0, remote: 1},
+		{op: insertChar, local: 1, char: 'a'},
+		{op: insertChar, local: 1, char: 'b'},
+	})
+	t0, t1 := trees[0], trees[1]
+	// Receive 'b' before 'a'.
+	t0.Integrate(t1.Yarns[1][1])
+	// Forking into a site with lower UUID remaps the pending atom.
+	t2, _ := t1.Fork()
+	t0.Merge(t2)
+	if s := t0.ToString(); s != "ab" {
+		t.Errorf("got %q, want %q", s, "ab")
+	}
+	if got := len(t0.Pending()); got != 0 {
+		t.Errorf("len(Pending()) = %d, want 0", got)
+	}
+}
+
+func TestIntegrateError(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	tests := []struct {
+		atom crdt.Atom
+		want error
+	}{
+		{crdt.Atom{ID: crdt.AtomID{Site: 1, Timestamp: 2}, Value: crdt.InsertChar{'a'}}, crdt.ErrUnknownSite},
+		{crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Site: 1, Timestamp: 1}, Value: crdt.InsertChar{'a'}}, crdt.ErrUnknownSite},
+		{crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Timestamp: 3}, Value: crdt.InsertChar{'a'}}, crdt.ErrInvalidAtom},
+	}
+	for _, test := range tests {
+		if err := tree.Integrate(test.atom); !errors.Is(err, test.want) {
+			t.Errorf("Integrate(%v): got %v, want %v", test.atom, err, test.want)
+		}
+	}
+}
+
+func TestIntegrateInconsistentAtoms(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertChar('a'); err != nil {
+		t.Fatal(err)
+	}
+	a := tree.Yarns[0][0].ID
+	ts := a.Timestamp
+	tests := []struct {
+		desc  string
+		atoms []crdt.Atom
+	}{
+		{"cause with different timestamp", []crdt.Atom{
+			{ID: crdt.AtomID{Index: 1, Timestamp: ts + 2}, Cause: crdt.AtomID{Timestamp: ts + 1}, Value: crdt.InsertChar{'b'}},
+		}},
+		{"timestamp not increasing in yarn", []crdt.Atom{
+			{ID: crdt.AtomID{Index: 1, Timestamp: ts}, Value: crdt.InsertChar{'b'}},
+		}},
+		{"conflicting atom in yarn", []crdt.Atom{
+			{ID: crdt.AtomID{Index: 0, Timestamp: ts + 1}, Value: crdt.InsertChar{'b'}},
+		}},
+		{"invalid child", []crdt.Atom{
+			{ID: crdt.AtomID{Index: 1, Timestamp: ts + 1}, Cause: a, Value: crdt.InsertAdd{1}},
+		}},
+		{"cause with different timestamp in same call", []crdt.Atom{
+			{ID: crdt.AtomID{Index: 2, Timestamp: ts + 3}, Cause: crdt.AtomID{Index: 1, Timestamp: ts + 2}, Value: crdt.InsertChar{'c'}},
+			{ID: crdt.AtomID{Index: 1, Timestamp: ts + 1}, Cause: a, Value: crdt.InsertChar{'b'}},
+		}},
+	}
+	for _, test := range tests {
+		if err := tree.Integrate(test.atoms...); !errors.Is(err, crdt.ErrInvalidAtom) {
+			t.Errorf("%s: got err %v, want %v", test.desc, err, crdt.ErrInvalidAtom)
+		}
+	}
+	if s := tree.ToString(); s != "a" {
+		t.Errorf("got %q, want %q", s, "a")
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIntegrateDropsInvalidPending(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertChar('a'); err != nil {
+		t.Fatal(err)
+	}
+	a := tree.Yarns[0][0].ID
+	b := crdt.AtomID{Index: 1, Timestamp: a.Timestamp + 1}
+	// The cause of the counter increment is missing, so it can't be checked yet.
+	add := crdt.Atom{ID: crdt.AtomID{Index: 2, Timestamp: a.Timestamp + 2}, Cause: b, Value: crdt.InsertAdd{1}}
+	if err := tree.Integrate(add); err != nil {
+		t.Fatalf("Integrate(%v): %v", add, err)
+	}
+	if err := tree.Integrate(crdt.Atom{ID: b, Cause: a, Value: crdt.InsertChar{'b'}}); err != nil {
+		t.Fatalf("Integrate(%v): %v", b, err)
+	}
+	if got := len(tree.Pending()); got != 0 {
+		t.Errorf("len(Pending()) = %d, want 0", got)
+	}
+	if s := tree.ToString(); s != "ab" {
+		t.Errorf("got %q, want %q", s, "ab")
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,249 @@
+package crdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// JSON encoding of a CausalTree.
+//
+// Trees are marshaled with the default encoding of their exported fields, plus the horizon,
+// and each atom value is marshaled as a JSON object with a "Type" tag, plus the fields of its payload, if any:
+//
+//   {"Type": "InsertChar", "Char": "x"}
+//   {"Type": "InsertAdd", "Value": -3}
+//   {"Type": "InsertKey", "Key": "name"}
+//   {"Type": "Set", "Int": 42}
+//   {"Type": "MarkStart", "Name": "bold", "Bool": true}
+//   {"Type": "Delete"}
+//
+// The tag is used to select the concrete type when unmarshaling. Atoms removed by Compact
+// have a null value.
+
+// Fields of a CausalTree in its JSON encoding.
+type jsonCausalTree struct {
+	Weave     []Atom
+	Cursor    AtomID
+	Yarns     [][]Atom
+	Sitemap   []uuid.UUID
+	SiteID    uuid.UUID
+	Timestamp uint32
+	Horizon   Weft `json:",omitempty"`
+}
+
+// Union of the payloads of all atom values.
+type jsonAtomValue struct {
+	Type  string
+	Char  *string
+	Value *int32
+	Key   *string
+	Name  *string
+	Str   *string
+	Int   *int64
+	Bool  *bool
+	Float *float64
+}
+
+// Returns the single scalar within the payload, or nil if there's none.
+func (v jsonAtomValue) scalar(data []byte) (interface{}, error) {
+	var values []interface{}
+	if v.Str != nil {
+		values = append(values, *v.Str)
+	}
+	if v.Int != nil {
+		values = append(values, *v.Int)
+	}
+	if v.Bool != nil {
+		values = append(values, *v.Bool)
+	}
+	if v.Float != nil {
+		values = append(values, *v.Float)
+	}
+	switch len(values) {
+	case 0:
+		return nil, nil
+	case 1:
+		return values[0], nil
+	}
+	return nil, fmt.Errorf("%w: %s must have at most one value, got %s", ErrInvalidEncoding, v.Type, data)
+}
+
+func unmarshalAtomValue(data []byte) (AtomValue, error) {
+	var v jsonAtomValue
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	switch v.Type {
+	case "InsertChar":
+		if v.Char == nil || utf8.RuneCountInString(*v.Char) != 1 {
+			return nil, fmt.Errorf("%w: InsertChar must have a single char, got %s", ErrInvalidEncoding, data)
+		}
+		ch, _ := utf8.DecodeRuneInString(*v.Char)
+		return InsertChar{ch}, nil
+	case "Delete":
+		return Delete{}, nil
+	case "InsertStr":
+		return InsertStr{}, nil
+	case "InsertAdd":
+		if v.Value == nil {
+			return nil, fmt.Errorf("%w: InsertAdd must have a value, got %s", ErrInvalidEncoding, data)
+		}
+		return InsertAdd{*v.Value}, nil
+	case "InsertCounter":
+		return InsertCounter{}, nil
+	case "InsertList":
+		return InsertList{}, nil
+	case "InsertElem":
+		return InsertElem{}, nil
+	case "InsertMap":
+		return InsertMap{}, nil
+	case "InsertKey":
+		if v.Key == nil {
+			return nil, fmt.Errorf("%w: InsertKey must have a key, got %s", ErrInvalidEncoding, data)
+		}
+		return InsertKey{*v.Key}, nil
+	case "InsertRegister":
+		return InsertRegister{}, nil
+	case "Set":
+		x, err := v.scalar(data)
+		if err != nil {
+			return nil, err
+		}
+		if x == nil {
+			return nil, fmt.Errorf("%w: Set must have a value, got %s", ErrInvalidEncoding, data)
+		}
+		return Set{x}, nil
+	case "InsertSet":
+		return InsertSet{}, nil
+	case "InsertMember":
+		x, err := v.scalar(data)
+		if err != nil {
+			return nil, err
+		}
+		if x == nil {
+			return nil, fmt.Errorf("%w: InsertMember must have a value, got %s", ErrInvalidEncoding, data)
+		}
+		return InsertMember{x}, nil
+	case "MarkStart":
+		if v.Name == nil {
+			return nil, fmt.Errorf("%w: MarkStart must have a name, got %s", ErrInvalidEncoding, data)
+		}
+		x, err := v.scalar(data)
+		if err != nil {
+			return nil, err
+		}
+		return MarkStart{*v.Name, x}, nil
+	case "MarkEnd":
+		return MarkEnd{}, nil
+	case "MoveFrom":
+		return MoveFrom{}, nil
+	case "MoveTo":
+		return MoveTo{}, nil
+	case "Tombstone":
+		return Tombstone{}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown atom value type %q", ErrInvalidEncoding, v.Type)
+}
+
+// UnmarshalJSON decodes an atom, selecting the concrete type of its value from its tag.
+func (a *Atom) UnmarshalJSON(data []byte) error {
+	var atom struct {
+		ID    AtomID
+		Cause AtomID
+		Value json.RawMessage
+	}
+	if err := json.Unmarshal(data, &atom); err != nil {
+		return err
+	}
+	if string(atom.Value) == "null" {
+		*a = Atom{ID: atom.ID, Cause: atom.Cause}
+		return nil
+	}
+	value, err := unmarshalAtomValue(atom.Value)
+	if err != nil {
+		return err
+	}
+	*a = Atom{ID: atom.ID, Cause: atom.Cause, Value: value}
+	return nil
+}
+
+// MarshalJSON encodes the tree's exported fields and its weave.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonCausalTree{
+		Weave:     t.Weave,
+		Cursor:    t.Cursor,
+		Yarns:     t.Yarns,
+		Sitemap:   t.Sitemap,
+		SiteID:    t.SiteID,
+		Timestamp: t.Timestamp,
+		Horizon:   t.horizon,
+	})
+}
+
+// UnmarshalJSON decodes a tree encoded with encoding/json, replacing the current contents.
+//
+// Time complexity: O(atoms + sites)
+func (t *CausalTree) UnmarshalJSON(data []byte) error {
+	var tree jsonCausalTree
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	if len(tree.Yarns) != len(tree.Sitemap) {
+		return fmt.Errorf("%w: %d yarns for %d sites", ErrInvalidEncoding, len(tree.Yarns), len(tree.Sitemap))
+	}
+	for i, yarn := range tree.Yarns {
+		for j, atom := range yarn {
+			if int(atom.ID.Site) != i || int(atom.ID.Index) != j {
+				return fmt.Errorf("%w: atom %v at position %d of yarn %d", ErrInvalidEncoding, atom.ID, j, i)
+			}
+		}
+	}
+	if err := checkDecodedTree(tree.Sitemap, tree.Yarns, tree.SiteID, tree.Cursor, tree.Horizon); err != nil {
+		return err
+	}
+	if err := checkDecodedWeave(tree.Weave, tree.Yarns); err != nil {
+		return err
+	}
+	return t.replaceDecoded(CausalTree{
+		Weave:     tree.Weave,
+		weave:     newWeave(tree.Weave),
+		horizon:   tree.Horizon,
+		Cursor:    tree.Cursor,
+		Yarns:     tree.Yarns,
+		Sitemap:   tree.Sitemap,
+		SiteID:    tree.SiteID,
+		Timestamp: tree.Timestamp,
+	})
+}
+
+// Checks that the weave contains exactly the same atoms as the yarns.
+func checkDecodedWeave(weave []Atom, yarns [][]Atom) error {
+	var numAtoms int
+	for _, yarn := range yarns {
+		for _, atom := range yarn {
+			if !isCompacted(atom) {
+				numAtoms++
+			}
+		}
+	}
+	if len(weave) != numAtoms {
+		return fmt.Errorf("%w: weave has %d atoms, yarns have %d", ErrInvalidEncoding, len(weave), numAtoms)
+	}
+	seen := make(map[AtomID]bool, numAtoms)
+	for _, atom := range weave {
+		id := atom.ID
+		if int(id.Site) >= len(yarns) || int(id.Index) >= len(yarns[id.Site]) || yarns[id.Site][id.Index] != atom {
+			return fmt.Errorf("%w: weave atom %v doesn't match yarns", ErrInvalidEncoding, atom)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: weave contains atom %v twice", ErrInvalidEncoding, id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
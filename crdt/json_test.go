@@ -0,0 +1,168 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestAtomJSON(t *testing.T) {
+	tests := []struct {
+		atom crdt.Atom
+		want string
+	}{
+		{
+			crdt.Atom{ID: crdt.AtomID{Site: 1, Index: 2, Timestamp: 3}, Value: crdt.InsertChar{'ç'}},
+			`{"ID":{"Site":1,"Index":2,"Timestamp":3},"Cause":{"Site":0,"Index":0,"Timestamp":0},"Value":{"Type":"InsertChar","Char":"ç"}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Timestamp: 1}, Value: crdt.Delete{}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":2},"Cause":{"Site":0,"Index":0,"Timestamp":1},"Value":{"Type":"Delete"}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 1}, Value: crdt.InsertStr{}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":1},"Cause":{"Site":0,"Index":0,"Timestamp":0},"Value":{"Type":"InsertStr"}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 1}, Value: crdt.InsertCounter{}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":1},"Cause":{"Site":0,"Index":0,"Timestamp":0},"Value":{"Type":"InsertCounter"}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Timestamp: 1}, Value: crdt.InsertAdd{-5}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":2},"Cause":{"Site":0,"Index":0,"Timestamp":1},"Value":{"Type":"InsertAdd","Value":-5}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Timestamp: 1}, Value: crdt.InsertKey{"k"}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":2},"Cause":{"Site":0,"Index":0,"Timestamp":1},"Value":{"Type":"InsertKey","Key":"k"}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Timestamp: 1}, Value: crdt.Set{int64(0)}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":2},"Cause":{"Site":0,"Index":0,"Timestamp":1},"Value":{"Type":"Set","Int":0}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Timestamp: 1}, Value: crdt.Set{false}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":2},"Cause":{"Site":0,"Index":0,"Timestamp":1},"Value":{"Type":"Set","Bool":false}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Timestamp: 1}, Value: crdt.MarkStart{"link", "x"}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":2},"Cause":{"Site":0,"Index":0,"Timestamp":1},"Value":{"Type":"MarkStart","Name":"link","Str":"x"}}`,
+		},
+		{
+			crdt.Atom{ID: crdt.AtomID{Timestamp: 2}, Cause: crdt.AtomID{Timestamp: 1}, Value: crdt.MarkStart{Name: "bold"}},
+			`{"ID":{"Site":0,"Index":0,"Timestamp":2},"Cause":{"Site":0,"Index":0,"Timestamp":1},"Value":{"Type":"MarkStart","Name":"bold"}}`,
+		},
+	}
+	for _, test := range tests {
+		bs, err := json.Marshal(test.atom)
+		if err != nil {
+			t.Fatalf("%v: json.Marshal: %v", test.atom, err)
+		}
+		if string(bs) != test.want {
+			t.Errorf("%v: got %s, want %s", test.atom, bs, test.want)
+		}
+		var got crdt.Atom
+		if err := json.Unmarshal(bs, &got); err != nil {
+			t.Fatalf("%v: json.Unmarshal: %v", test.atom, err)
+		}
+		if got != test.atom {
+			t.Errorf("round-trip: got %v, want %v", got, test.atom)
+		}
+	}
+}
+
+func TestAtomJSONError(t *testing.T) {
+	tests := []string{
+		`{"Value":"insert x"}`,
+		`{"Value":{"Type":"InsertChar"}}`,
+		`{"Value":{"Type":"InsertChar","Char":"xy"}}`,
+		`{"Value":{"Type":"InsertAdd"}}`,
+		`{"Value":{"Type":"InsertKey"}}`,
+		`{"Value":{"Type":"Set"}}`,
+		`{"Value":{"Type":"Set","Str":"x","Int":1}}`,
+		`{"Value":{"Type":"InsertMember"}}`,
+		`{"Value":{"Type":"MarkStart","Bool":true}}`,
+		`{"Value":{"Type":"Unknown"}}`,
+	}
+	for _, test := range tests {
+		var atom crdt.Atom
+		if err := json.Unmarshal([]byte(test), &atom); err == nil {
+			t.Errorf("%s: got nil, want err (atom: %v)", test, atom)
+		}
+	}
+}
+
+func TestCausalTreeJSON(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := setupTestView(t)
+	trees[1].InsertCounter()
+	trees[1].InsertAdd(7)
+
+	// Trees are encoded within other structures, like in debug logs.
+	bs, err := json.Marshal(map[string]interface{}{"Sites": trees})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	var got struct{ Sites []*crdt.CausalTree }
+	if err := json.Unmarshal(bs, &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(trees, got.Sites, treeOpts); diff != "" {
+		t.Errorf("round-trip (-want, +got):\n%s", diff)
+	}
+	// Decoded trees are fully functional.
+	got.Sites[0].Merge(got.Sites[1])
+	if s := got.Sites[0].ToString(); s != "$0xabdyefg" {
+		t.Errorf("got %q, want %q", s, "$0xabdyefg")
+	}
+}
+
+func TestCausalTreeJSONError(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := setupTestView(t)
+	// Corrupts the JSON representation of a tree.
+	corrupt := func(f func(fields map[string]interface{})) []byte {
+		bs, _ := json.Marshal(trees[0])
+		var fields map[string]interface{}
+		json.Unmarshal(bs, &fields)
+		f(fields)
+		bs, _ = json.Marshal(fields)
+		return bs
+	}
+	list := func(fields map[string]interface{}, key string) []interface{} {
+		return fields[key].([]interface{})
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"missing yarn", corrupt(func(m map[string]interface{}) { m["Yarns"] = list(m, "Yarns")[:1] })},
+		{"missing weave atom", corrupt(func(m map[string]interface{}) { m["Weave"] = list(m, "Weave")[1:] })},
+		{"duplicate weave atom", corrupt(func(m map[string]interface{}) { list(m, "Weave")[1] = list(m, "Weave")[0] })},
+		{"unknown site", corrupt(func(m map[string]interface{}) { m["SiteID"] = uuid.Nil })},
+		{"unknown cursor", corrupt(func(m map[string]interface{}) { m["Cursor"].(map[string]interface{})["Index"] = 100 })},
+		{"unsorted sitemap", corrupt(func(m map[string]interface{}) {
+			sitemap := list(m, "Sitemap")
+			sitemap[0], sitemap[1] = sitemap[1], sitemap[0]
+		})},
+	}
+	for _, test := range tests {
+		tree := new(crdt.CausalTree)
+		if err := json.Unmarshal(test.data, tree); !errors.Is(err, crdt.ErrInvalidEncoding) {
+			t.Errorf("%s: got err %v, want %v", test.name, err, crdt.ErrInvalidEncoding)
+		}
+	}
+}
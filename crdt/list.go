@@ -0,0 +1,226 @@
+package crdt
+
+// +------------+
+// | List value |
+// +------------+
+
+// List is a Container of elements in a specific order, represented as a []interface{}.
+type List struct {
+	treePosition
+}
+
+func (*List) isValue() {}
+
+// Snapshot returns the Go representation of the list's visible elements. Empty elements are
+// represented as nil.
+//
+// Time complexity: O(log(atoms) + block size)
+func (l *List) Snapshot() []interface{} {
+	return snapshotList(l.block())
+}
+
+// Len returns the number of visible elements.
+//
+// Time complexity: O(log(atoms) + block size)
+func (l *List) Len() int {
+	return len(listElems(l.block()))
+}
+
+// Cursor returns a cursor positioned at the list's head.
+func (l *List) Cursor() *ListCursor {
+	return &ListCursor{head: l.treePosition, pos: l.treePosition}
+}
+
+// Returns the visible elements within a list's block, in order.
+func listElems(block []weaveAtom) []seqItem {
+	return sequence(block, isElem)
+}
+
+func isElem(value AtomValue) bool {
+	_, ok := value.(InsertElem)
+	return ok
+}
+
+func snapshotList(block []weaveAtom) []interface{} {
+	elems := listElems(block)
+	xs := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		j := elem.item
+		values := registerValues(block, block[j].ID, j+1)
+		if len(values) == 0 {
+			continue
+		}
+		k := values[0]
+		xs[i] = snapshotBlock(block[k : k+weaveBlockSize(block, k)])
+	}
+	return xs
+}
+
+// +--------------+
+// | List element |
+// +--------------+
+
+// Elem is a list's element, that is a Register for any other value.
+type Elem struct {
+	treePosition
+}
+
+// SetString sets the element to an empty string.
+func (e *Elem) SetString() (*String, error) {
+	p, err := register{e.treePosition}.set(InsertStr{})
+	if err != nil {
+		return nil, err
+	}
+	return &String{p}, nil
+}
+
+// SetCounter sets the element to a zeroed counter.
+func (e *Elem) SetCounter() (*Counter, error) {
+	p, err := register{e.treePosition}.set(InsertCounter{})
+	if err != nil {
+		return nil, err
+	}
+	return &Counter{p}, nil
+}
+
+// SetList sets the element to an empty list.
+func (e *Elem) SetList() (*List, error) {
+	p, err := register{e.treePosition}.set(InsertList{})
+	if err != nil {
+		return nil, err
+	}
+	return &List{p}, nil
+}
+
+// SetMap sets the element to an empty map.
+func (e *Elem) SetMap() (*Map, error) {
+	p, err := register{e.treePosition}.set(InsertMap{})
+	if err != nil {
+		return nil, err
+	}
+	return &Map{p}, nil
+}
+
+// SetRegister sets the element to an empty last-writer-wins register.
+func (e *Elem) SetRegister() (*LWWRegister, error) {
+	p, err := register{e.treePosition}.set(InsertRegister{})
+	if err != nil {
+		return nil, err
+	}
+	return &LWWRegister{p}, nil
+}
+
+// SetORSet sets the element to an empty observed-remove set.
+func (e *Elem) SetORSet() (*ORSet, error) {
+	p, err := register{e.treePosition}.set(InsertSet{})
+	if err != nil {
+		return nil, err
+	}
+	return &ORSet{p}, nil
+}
+
+// Clear deletes the element's value.
+func (e *Elem) Clear() error {
+	return register{e.treePosition}.clear()
+}
+
+// Value returns the element's latest visible value, or nil if it's empty.
+//
+// Time complexity: O(log(atoms) + block size)
+func (e *Elem) Value() Value {
+	return register{e.treePosition}.value()
+}
+
+// +-------------+
+// | List cursor |
+// +-------------+
+
+// ListCursor walks and modifies a List.
+//
+// It holds the position of the causing atom for the next insertion, and it's moved to the
+// closest non-deleted ancestor if its element is deleted by another site.
+type ListCursor struct {
+	head, pos treePosition
+}
+
+// Returns the ID of the cursor's atom, or of its first non-deleted ancestor within the list.
+func (c *ListCursor) atomID() AtomID {
+	return c.pos.tree.undeletedWithin(c.pos.atomID(), c.head.atomID())
+}
+
+// Index moves the cursor to the i-th visible element. Use i = -1 to move it to the list's head,
+// so that elements are inserted at the beginning.
+//
+// Time complexity: O(log(atoms) + block size)
+func (c *ListCursor) Index(i int) error {
+	block := c.head.block()
+	elems := listElems(block)
+	if i < -1 || i >= len(elems) {
+		return ErrCursorOutOfRange
+	}
+	if i == -1 {
+		c.pos = c.head
+		return nil
+	}
+	c.pos = c.pos.tree.positionOf(block[elems[i].place].ID)
+	return nil
+}
+
+// Element returns the element at the cursor.
+func (c *ListCursor) Element() (*Elem, error) {
+	atomID := c.atomID()
+	if atomID == c.head.atomID() {
+		return nil, ErrCursorAtHead
+	}
+	t := c.pos.tree
+	return &Elem{t.positionOf(t.movedAtom(atomID))}, nil
+}
+
+// Insert inserts an empty element after the cursor, and advances the cursor to it.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (c *ListCursor) Insert() (*Elem, error) {
+	t := c.pos.tree
+	atomID, err := t.addAtomAt(c.atomID(), InsertElem{})
+	if err != nil {
+		return nil, err
+	}
+	c.pos = t.positionOf(atomID)
+	return &Elem{c.pos}, nil
+}
+
+// Delete deletes the element at the cursor and its value, and moves the cursor to the previous
+// element.
+//
+// Time complexity: O(log(atoms) + block size + log(sites))
+func (c *ListCursor) Delete() error {
+	t := c.pos.tree
+	atomID := c.atomID()
+	if atomID == c.head.atomID() {
+		return ErrCursorAtHead
+	}
+	block := c.head.block()
+	elems := listElems(block)
+	k := findPlace(block, elems, atomID)
+	elemID := t.movedAtom(atomID)
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	// The element is deleted before its value, so that Undo restores them in order. The value is
+	// looked up beforehand, since it's buried along with the element.
+	valueBlock, values := register{t.positionOf(elemID)}.values()
+	if _, err := t.addAtomAt(elemID, Delete{}); err != nil {
+		return err
+	}
+	if err := t.deleteValues(valueBlock, values); err != nil {
+		return err
+	}
+	switch {
+	case k > 0:
+		c.pos = t.positionOf(block[elems[k-1].place].ID)
+	case k == 0:
+		c.pos = c.head
+	default:
+		c.pos = t.positionOf(t.undeletedWithin(atomID, c.head.atomID()))
+	}
+	return nil
+}
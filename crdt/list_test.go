@@ -0,0 +1,297 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Builds the list ["abc", [null], 3] as the tree's value.
+func setupNestedList(t *testing.T) (*crdt.CausalTree, *crdt.List) {
+	tree := crdt.NewCausalTree()
+	l, err := tree.SetList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := l.Cursor()
+	steps := []func() error{
+		func() error {
+			e, err := c.Insert()
+			if err != nil {
+				return err
+			}
+			s, err := e.SetString()
+			if err != nil {
+				return err
+			}
+			sc := s.Cursor()
+			for _, ch := range "abc" {
+				if err := sc.Insert(ch); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		func() error {
+			e, err := c.Insert()
+			if err != nil {
+				return err
+			}
+			inner, err := e.SetList()
+			if err != nil {
+				return err
+			}
+			_, err = inner.Cursor().Insert()
+			return err
+		},
+		func() error {
+			e, err := c.Insert()
+			if err != nil {
+				return err
+			}
+			cnt, err := e.SetCounter()
+			if err != nil {
+				return err
+			}
+			return cnt.Increment(3)
+		},
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+	}
+	return tree, l
+}
+
+func TestList(t *testing.T) {
+	tree, l := setupNestedList(t)
+	want := []interface{}{"abc", []interface{}{nil}, int32(3)}
+	if diff := cmp.Diff(want, l.Snapshot()); diff != "" {
+		t.Errorf("Snapshot (-want, +got):\n%s", diff)
+	}
+	if l.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", l.Len())
+	}
+	if s := tree.ToString(); s != "[,*abc,[,,$0" {
+		t.Errorf("ToString() = %q, want %q", s, "[,*abc,[,,$0")
+	}
+	data, err := tree.ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	wantJSON := `[
+    [
+        "abc",
+        [
+            null
+        ],
+        3
+    ]
+]`
+	if string(data) != wantJSON {
+		t.Errorf("ToJSON() = %s, want %s", data, wantJSON)
+	}
+
+	// Edit elements through a cursor.
+	c := l.Cursor()
+	if err := c.Index(0); err != nil {
+		t.Fatalf("Index(0): %v", err)
+	}
+	e, err := c.Element()
+	if err != nil {
+		t.Fatalf("Element: %v", err)
+	}
+	s := e.Value().(*crdt.String)
+	sc := s.Cursor()
+	if err := sc.Index(1); err != nil {
+		t.Fatalf("Index(1): %v", err)
+	}
+	if err := sc.Delete(); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := sc.Insert('x'); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if got := s.Snapshot(); got != "axc" {
+		t.Errorf("string: got %q, want %q", got, "axc")
+	}
+	if err := c.Index(1); err != nil {
+		t.Fatalf("Index(1): %v", err)
+	}
+	if err := c.Delete(); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := c.Insert(); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	want = []interface{}{"axc", nil, int32(3)}
+	if diff := cmp.Diff(want, tree.Snapshot()); diff != "" {
+		t.Errorf("Snapshot (-want, +got):\n%s", diff)
+	}
+	// Deleting an element is undone at once, restoring its value.
+	if err := tree.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if err := tree.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	want = []interface{}{"axc", []interface{}{nil}, int32(3)}
+	if diff := cmp.Diff(want, tree.Snapshot()); diff != "" {
+		t.Errorf("Undo (-want, +got):\n%s", diff)
+	}
+}
+
+func TestListDeleteBuriesValue(t *testing.T) {
+	t0, l := setupStringList(t, "a", "b")
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// t1 sets the first element while t0 deletes it.
+	c1 := t1.Value().(*crdt.List).Cursor()
+	if err := c1.Index(0); err != nil {
+		t.Fatal(err)
+	}
+	e1, err := c1.Element()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e1.SetCounter(); err != nil {
+		t.Fatal(err)
+	}
+	c := l.Cursor()
+	if err := c.Index(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if got := t0.ToString(); got != "[,*b" {
+		t.Errorf("ToString() = %q, want %q", got, "[,*b")
+	}
+	if diff := cmp.Diff([]interface{}{"b"}, t0.Snapshot()); diff != "" {
+		t.Errorf("Snapshot (-want, +got):\n%s", diff)
+	}
+	if err := t0.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListCursorErrors(t *testing.T) {
+	_, l := setupNestedList(t)
+	c := l.Cursor()
+	if _, err := c.Element(); !errors.Is(err, crdt.ErrCursorAtHead) {
+		t.Errorf("Element at head: got err %v, want %v", err, crdt.ErrCursorAtHead)
+	}
+	if err := c.Delete(); !errors.Is(err, crdt.ErrCursorAtHead) {
+		t.Errorf("Delete at head: got err %v, want %v", err, crdt.ErrCursorAtHead)
+	}
+	for _, i := range []int{-2, 3} {
+		if err := c.Index(i); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+			t.Errorf("Index(%d): got err %v, want %v", i, err, crdt.ErrCursorOutOfRange)
+		}
+	}
+}
+
+func TestListConcurrent(t *testing.T) {
+	t0, l0 := setupNestedList(t)
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1 := t1.Value().(*crdt.List)
+	// t0 inserts an element at the beginning, and t1 deletes the counter and appends a string.
+	e0, err := l0.Cursor().Insert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e0.SetCounter(); err != nil {
+		t.Fatal(err)
+	}
+	c1 := l1.Cursor()
+	if err := c1.Index(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c1.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c1.Index(1); err != nil {
+		t.Fatal(err)
+	}
+	e1, err := c1.Insert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err := e1.SetString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.Cursor().Insert('z'); err != nil {
+		t.Fatal(err)
+	}
+	// Handles remain valid after the sites are remapped by the merge.
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int32(0), "abc", []interface{}{nil}, "z"}
+	if diff := cmp.Diff(want, l0.Snapshot()); diff != "" {
+		t.Errorf("t0 (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, l1.Snapshot()); diff != "" {
+		t.Errorf("t1 (-want, +got):\n%s", diff)
+	}
+}
+
+func TestListViewAndEncoding(t *testing.T) {
+	tree, l := setupNestedList(t)
+	weft := tree.Now()
+	c := l.Cursor()
+	if err := c.Index(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"abc", []interface{}{nil}, int32(3)}
+	view, err := tree.ViewAt(weft)
+	if err != nil {
+		t.Fatalf("ViewAt: %v", err)
+	}
+	if diff := cmp.Diff(want, view.Snapshot()); diff != "" {
+		t.Errorf("ViewAt (-want, +got):\n%s", diff)
+	}
+
+	want = []interface{}{[]interface{}{nil}, int32(3)}
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got := new(crdt.CausalTree)
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if diff := cmp.Diff(want, got.Snapshot()); diff != "" {
+		t.Errorf("binary round-trip (-want, +got):\n%s", diff)
+	}
+	data, err = json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got = new(crdt.CausalTree)
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(want, got.Snapshot()); diff != "" {
+		t.Errorf("JSON round-trip (-want, +got):\n%s", diff)
+	}
+}
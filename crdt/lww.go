@@ -0,0 +1,66 @@
+package crdt
+
+// +---------------------------+
+// | Last-writer-wins register |
+// +---------------------------+
+
+// LWWRegister is a register of a scalar value: a string, int64, bool or float64.
+//
+// Each assignment creates a Set atom, and the greatest visible one by AtomID.Compare is the
+// register's value. That is, concurrent assignments are resolved by Lamport timestamp, and then
+// by site order. If an assignment is undone, the previous one is visible again.
+type LWWRegister struct {
+	treePosition
+}
+
+func (*LWWRegister) isValue() {}
+
+// Snapshot returns the register's value, or nil if it was never set.
+//
+// Time complexity: O(log(atoms) + block size)
+func (r *LWWRegister) Snapshot() interface{} {
+	return snapshotRegister(r.block())
+}
+
+// Get returns the register's value, and whether it was set.
+//
+// Time complexity: O(log(atoms) + block size)
+func (r *LWWRegister) Get() (interface{}, bool) {
+	x := r.Snapshot()
+	return x, x != nil
+}
+
+// Set assigns a value to the register. Values of type int are converted to int64, and other types
+// return ErrInvalidScalar.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (r *LWWRegister) Set(x interface{}) error {
+	value, err := scalarValue(x)
+	if err != nil {
+		return err
+	}
+	_, err = r.tree.addAtomAt(r.atomID(), Set{value})
+	return err
+}
+
+// Returns the index of the winning assignment within a register's block, or -1 if there's none.
+func registerAssignment(block []weaveAtom) int {
+	winner := -1
+	for j := 1; j < len(block); j++ {
+		if _, ok := block[j].Value.(Set); !ok || !block[j].isVisible() {
+			continue
+		}
+		if winner < 0 || block[j].ID.Compare(block[winner].ID) > 0 {
+			winner = j
+		}
+	}
+	return winner
+}
+
+func snapshotRegister(block []weaveAtom) interface{} {
+	j := registerAssignment(block)
+	if j < 0 {
+		return nil
+	}
+	return block[j].Value.(Set).Value
+}
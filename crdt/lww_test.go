@@ -0,0 +1,146 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ crdt.Value = (*crdt.LWWRegister)(nil)
+
+func TestLWWRegister(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	r, err := tree.SetRegister()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, ok := r.Get(); ok {
+		t.Fatalf("empty register: got %v", x)
+	}
+	steps := []struct {
+		f    func() error
+		want interface{}
+	}{
+		{func() error { return r.Set("title") }, "title"},
+		{func() error { return r.Set(42) }, int64(42)},
+		{func() error { return r.Set(true) }, true},
+		{func() error { return r.Set(1.5) }, 1.5},
+		// Undoing an assignment reveals the previous one.
+		{func() error { return tree.Undo() }, true},
+		{func() error { return tree.Redo() }, 1.5},
+		{func() error { return tree.Clear() }, nil},
+		{func() error { return tree.Undo() }, 1.5},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if diff := cmp.Diff(step.want, tree.Snapshot()); diff != "" {
+			t.Fatalf("step #%d: (-want, +got):\n%s", i, diff)
+		}
+	}
+	for _, x := range []interface{}{nil, 'x', []byte("x"), math.NaN(), math.Inf(-1)} {
+		if err := r.Set(x); !errors.Is(err, crdt.ErrInvalidScalar) {
+			t.Errorf("Set(%v): got err %v, want %v", x, err, crdt.ErrInvalidScalar)
+		}
+	}
+}
+
+func TestLWWRegisterConcurrent(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	r0, err := t0.SetRegister()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1 := t1.Value().(*crdt.LWWRegister)
+	// t1 sets the register twice, so its last value has a greater timestamp.
+	if err := r0.Set("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.Set("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.Set("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range []*crdt.LWWRegister{r0, r1} {
+		if x := r.Snapshot(); x != "c" {
+			t.Errorf("t%d: got %v, want %q", i, x, "c")
+		}
+	}
+}
+
+func TestLWWRegisterEncoding(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	m, err := tree.SetMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{
+		"title":  "Causal trees",
+		"draft":  true,
+		"pages":  int64(-12),
+		"rating": 4.25,
+	}
+	for key, x := range values {
+		r, err := m.Key(key).SetRegister()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Set(x); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := tree.ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	wantJSON := `[
+    {
+        "draft": true,
+        "pages": -12,
+        "rating": 4.25,
+        "title": "Causal trees"
+    }
+]`
+	if string(data) != wantJSON {
+		t.Errorf("ToJSON() = %s, want %s", data, wantJSON)
+	}
+
+	data, err = tree.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got := new(crdt.CausalTree)
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if diff := cmp.Diff(values, got.Snapshot()); diff != "" {
+		t.Errorf("binary round-trip (-want, +got):\n%s", diff)
+	}
+	data, err = json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got = new(crdt.CausalTree)
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(values, got.Snapshot()); diff != "" {
+		t.Errorf("JSON round-trip (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,214 @@
+package crdt
+
+import (
+	"sort"
+)
+
+// +-----------+
+// | Map value |
+// +-----------+
+
+// Map is a Container of values indexed by string keys, represented as a map[string]interface{}.
+//
+// Each key is assigned by an InsertKey atom, that holds the key's value as a register. Assigning a
+// key again creates a new InsertKey atom, and concurrent assignments to the same key are
+// resolved by picking the greatest one by AtomID.Compare.
+type Map struct {
+	treePosition
+}
+
+func (*Map) isValue() {}
+
+// Snapshot returns the Go representation of the map's visible keys. Keys without a value are
+// represented as nil.
+//
+// Time complexity: O(log(atoms) + block size)
+func (m *Map) Snapshot() map[string]interface{} {
+	return snapshotMap(m.block())
+}
+
+// Len returns the number of visible keys.
+//
+// Time complexity: O(log(atoms) + block size)
+func (m *Map) Len() int {
+	return len(mapKeys(m.block()))
+}
+
+// Keys returns the visible keys in lexicographical order.
+//
+// Time complexity: O(log(atoms) + block size + keys*log(keys))
+func (m *Map) Keys() []string {
+	keys := mapKeys(m.block())
+	xs := make([]string, 0, len(keys))
+	for key := range keys {
+		xs = append(xs, key)
+	}
+	sort.Strings(xs)
+	return xs
+}
+
+// Key returns a register for a key within the map, that may or not be present.
+func (m *Map) Key(key string) *Key {
+	return &Key{m.treePosition, key}
+}
+
+// Returns the index of the winning assignment of each visible key within a map's block.
+func mapKeys(block []weaveAtom) map[string]int {
+	keys := make(map[string]int)
+	for j := 1; j < len(block); {
+		value, ok := block[j].Value.(InsertKey)
+		if !ok {
+			j++
+			continue
+		}
+		if i, ok := keys[value.Key]; block[j].isVisible() && (!ok || block[j].ID.Compare(block[i].ID) > 0) {
+			keys[value.Key] = j
+		}
+		// Skip key's value.
+		j += weaveBlockSize(block, j)
+	}
+	return keys
+}
+
+func snapshotMap(block []weaveAtom) map[string]interface{} {
+	m := make(map[string]interface{})
+	for key, j := range mapKeys(block) {
+		values := registerValues(block, block[j].ID, j+1)
+		if len(values) == 0 {
+			m[key] = nil
+			continue
+		}
+		k := values[0]
+		m[key] = snapshotBlock(block[k : k+weaveBlockSize(block, k)])
+	}
+	return m
+}
+
+// +---------+
+// | Map key |
+// +---------+
+
+// Key is a Register for a key within a map.
+//
+// Unlike other registers, setting a key doesn't delete its previous value, but creates a new
+// assignment that takes precedence. If this assignment is undone, the previous one is visible
+// again.
+type Key struct {
+	m   treePosition
+	key string
+}
+
+// Returns the position of the winning assignment, or false if the key is not present.
+func (k *Key) assignment() (treePosition, bool) {
+	block := k.m.block()
+	j, ok := mapKeys(block)[k.key]
+	if !ok {
+		return treePosition{}, false
+	}
+	return k.m.tree.positionOf(block[j].ID), true
+}
+
+// Creates a new assignment for this key, with the given value.
+func (k *Key) set(value AtomValue) (treePosition, error) {
+	t := k.m.tree
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	keyID, err := t.addAtomAt(k.m.atomID(), InsertKey{k.key})
+	if err != nil {
+		return treePosition{}, err
+	}
+	atomID, err := t.addAtomAt(keyID, value)
+	if err != nil {
+		return treePosition{}, err
+	}
+	return t.positionOf(atomID), nil
+}
+
+// SetString assigns an empty string to the key.
+func (k *Key) SetString() (*String, error) {
+	p, err := k.set(InsertStr{})
+	if err != nil {
+		return nil, err
+	}
+	return &String{p}, nil
+}
+
+// SetCounter assigns a zeroed counter to the key.
+func (k *Key) SetCounter() (*Counter, error) {
+	p, err := k.set(InsertCounter{})
+	if err != nil {
+		return nil, err
+	}
+	return &Counter{p}, nil
+}
+
+// SetList assigns an empty list to the key.
+func (k *Key) SetList() (*List, error) {
+	p, err := k.set(InsertList{})
+	if err != nil {
+		return nil, err
+	}
+	return &List{p}, nil
+}
+
+// SetMap assigns an empty map to the key.
+func (k *Key) SetMap() (*Map, error) {
+	p, err := k.set(InsertMap{})
+	if err != nil {
+		return nil, err
+	}
+	return &Map{p}, nil
+}
+
+// SetRegister assigns an empty last-writer-wins register to the key.
+func (k *Key) SetRegister() (*LWWRegister, error) {
+	p, err := k.set(InsertRegister{})
+	if err != nil {
+		return nil, err
+	}
+	return &LWWRegister{p}, nil
+}
+
+// SetORSet assigns an empty observed-remove set to the key.
+func (k *Key) SetORSet() (*ORSet, error) {
+	p, err := k.set(InsertSet{})
+	if err != nil {
+		return nil, err
+	}
+	return &ORSet{p}, nil
+}
+
+// Clear removes the key from the map, deleting all of its visible assignments.
+//
+// Time complexity: O(block size + (assignments) * (log(atoms) + log(sites)))
+func (k *Key) Clear() error {
+	t := k.m.tree
+	block := k.m.block()
+	var assignments []AtomID
+	for j := 1; j < len(block); j += weaveBlockSize(block, j) {
+		if value, ok := block[j].Value.(InsertKey); ok && value.Key == k.key && block[j].isVisible() {
+			assignments = append(assignments, block[j].ID)
+		}
+	}
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	// Assignments are sorted from newest to oldest. Delete the oldest first, so that Undo
+	// restores them in the same order.
+	for i := len(assignments) - 1; i >= 0; i-- {
+		if _, err := t.addAtomAt(assignments[i], Delete{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Value returns the key's value, or nil if it's not present or empty.
+//
+// Time complexity: O(log(atoms) + block size)
+func (k *Key) Value() Value {
+	p, ok := k.assignment()
+	if !ok {
+		return nil
+	}
+	return register{p}.value()
+}
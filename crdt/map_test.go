@@ -0,0 +1,235 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	_ crdt.Register  = (*crdt.Key)(nil)
+	_ crdt.Container = (*crdt.Map)(nil)
+)
+
+func TestMap(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	m, err := tree.SetMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		f    func() error
+		want map[string]interface{}
+	}{
+		{func() error {
+			s, err := m.Key("name").SetString()
+			if err != nil {
+				return err
+			}
+			return s.Cursor().Insert('x')
+		}, map[string]interface{}{"name": "x"}},
+		{func() error {
+			cnt, err := m.Key("age").SetCounter()
+			if err != nil {
+				return err
+			}
+			return cnt.Increment(42)
+		}, map[string]interface{}{"name": "x", "age": int32(42)}},
+		{func() error {
+			inner, err := m.Key("address").SetMap()
+			if err != nil {
+				return err
+			}
+			_, err = inner.Key("city").SetString()
+			return err
+		}, map[string]interface{}{"name": "x", "age": int32(42), "address": map[string]interface{}{"city": ""}}},
+		// Assigning a key again replaces its value.
+		{func() error {
+			_, err := m.Key("name").SetCounter()
+			return err
+		}, map[string]interface{}{"name": int32(0), "age": int32(42), "address": map[string]interface{}{"city": ""}}},
+		{func() error { return m.Key("address").Clear() }, map[string]interface{}{"name": int32(0), "age": int32(42)}},
+		// Removing a key deletes all of its assignments.
+		{func() error { return m.Key("name").Clear() }, map[string]interface{}{"age": int32(42)}},
+		{func() error { return tree.Undo() }, map[string]interface{}{"name": int32(0), "age": int32(42)}},
+		{func() error { return tree.Undo() }, map[string]interface{}{"name": int32(0), "age": int32(42), "address": map[string]interface{}{"city": ""}}},
+		// Undoing an assignment reveals the previous one.
+		{func() error { return tree.Undo() }, map[string]interface{}{"name": "x", "age": int32(42), "address": map[string]interface{}{"city": ""}}},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if diff := cmp.Diff(step.want, m.Snapshot()); diff != "" {
+			t.Fatalf("step #%d: (-want, +got):\n%s", i, diff)
+		}
+	}
+	if diff := cmp.Diff([]string{"address", "age", "name"}, m.Keys()); diff != "" {
+		t.Errorf("Keys() (-want, +got):\n%s", diff)
+	}
+	if _, ok := m.Key("age").Value().(*crdt.Counter); !ok {
+		t.Errorf("got value %T, want *crdt.Counter", m.Key("age").Value())
+	}
+	if v := m.Key("missing").Value(); v != nil {
+		t.Errorf("got value %v for missing key", v)
+	}
+
+	data, err := tree.ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	wantJSON := `[
+    {
+        "address": {
+            "city": ""
+        },
+        "age": 42,
+        "name": "x"
+    }
+]`
+	if string(data) != wantJSON {
+		t.Errorf("ToJSON() = %s, want %s", data, wantJSON)
+	}
+}
+
+func TestMapConcurrent(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if _, err := t0.SetMap(); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m0, m1 := t0.Value().(*crdt.Map), t1.Value().(*crdt.Map)
+	if _, err := m0.Key("k").SetString(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m1.Key("k").SetCounter(); err != nil {
+		t.Fatal(err)
+	}
+	// Both assignments have the same timestamp, and the one from the first site in the sitemap wins.
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	s0, s1 := m0.Snapshot(), m1.Snapshot()
+	if diff := cmp.Diff(s0, s1); diff != "" {
+		t.Fatalf("diverged (-t0, +t1):\n%s", diff)
+	}
+	want := map[string]interface{}{"k": int32(0)}
+	if t0.SiteID.String() < t1.SiteID.String() {
+		want = map[string]interface{}{"k": ""}
+	}
+	if diff := cmp.Diff(want, s0); diff != "" {
+		t.Errorf("(-want, +got):\n%s", diff)
+	}
+	// A concurrent assignment survives the key's removal.
+	t2, err := t1.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m0.Key("k").Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := t2.Value().(*crdt.Map).Key("k").SetList(); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t2); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]interface{}{"k": []interface{}{}}
+	if diff := cmp.Diff(want, m0.Snapshot()); diff != "" {
+		t.Errorf("(-want, +got):\n%s", diff)
+	}
+}
+
+func TestMapEncoding(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	m, err := tree.SetMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := m.Key("ключ").SetList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := l.Cursor().Insert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.SetMap(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"ключ": []interface{}{map[string]interface{}{}}}
+
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got := new(crdt.CausalTree)
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if diff := cmp.Diff(want, got.Snapshot()); diff != "" {
+		t.Errorf("binary round-trip (-want, +got):\n%s", diff)
+	}
+	data, err = json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got = new(crdt.CausalTree)
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(want, got.Snapshot()); diff != "" {
+		t.Errorf("JSON round-trip (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMapClearBuriesValue(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	m, err := t0.SetMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Key("k").SetString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cursor().Insert('a'); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// t1 edits the value while t0 removes the key.
+	s1 := t1.Value().(*crdt.Map).Key("k").Value().(*crdt.String)
+	if err := s1.Cursor().Insert('b'); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Key("k").Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if got := t0.ToString(); got != "{" {
+		t.Errorf("ToString() = %q, want %q", got, "{")
+	}
+	if err := t0.SetCursor(1); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+		t.Errorf("SetCursor(1): got err %v, want %v", err, crdt.ErrCursorOutOfRange)
+	}
+	if diff := cmp.Diff(map[string]interface{}{}, t0.Snapshot()); diff != "" {
+		t.Errorf("Snapshot (-want, +got):\n%s", diff)
+	}
+	if err := t0.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,215 @@
+package crdt
+
+// +------------------+
+// | Formatting marks |
+// +------------------+
+
+/*
+Text may be formatted with marks, that assign a value to an attribute (e.g., bold=true) over a
+range of chars. A mark is made of two atoms: a MarkStart anchored at the first char, and a
+MarkEnd anchored at the last char, created one after the other by the same site. Text inserted
+within the range is also formatted, but not text inserted right before or after it.
+
+Marks are not visible in ToString nor change tree positions. Overlapping marks with different
+attributes are all applied, and if they have the same attribute, the greatest mark by
+AtomID.Compare wins over their intersection. That is, concurrent formatting of overlapping
+ranges is merged for each char, like a last-writer-wins register per attribute.
+*/
+
+// Span is a run of text with the same formatting attributes.
+type Span struct {
+	Text string
+	// Formatting attributes of the text, or nil if it's not formatted.
+	Attrs map[string]interface{}
+}
+
+// Format applies a formatting attribute to the atoms from the (tree) positions in the range
+// [from, to). The range must start and end at chars. A nil value removes the attribute.
+//
+// Values of type int are converted to int64, and other types than string, int64, bool and float64
+// return ErrInvalidScalar.
+//
+// Time complexity: O(log(atoms) + (to - from) + (avg. block size) + log(sites)), or O(atoms) if some
+// atom was moved
+func (t *CausalTree) Format(from, to int, name string, value interface{}) error {
+	atoms, err := t.atomsInRange(from, to)
+	if err != nil || from == to {
+		return err
+	}
+	return t.format(atoms[0].ID, atoms[len(atoms)-1].ID, name, value)
+}
+
+// Spans returns the tree's contents split in runs of text with the same formatting attributes.
+// The concatenation of the spans' text is equal to ToString.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) Spans() []Span {
+	v := t.flatView()
+	return t.spans(v.atoms, v.order)
+}
+
+// Format applies a formatting attribute to the chars in the range [from, to). See CausalTree.Format.
+//
+// Time complexity: O(log(atoms) + block size + log(sites))
+func (s *String) Format(from, to int, name string, value interface{}) error {
+	block := s.block()
+	chars := stringChars(block)
+	if from < 0 || to < from || to > len(chars) {
+		return ErrCursorOutOfRange
+	}
+	if from == to {
+		return nil
+	}
+	return s.tree.format(block[chars[from].item].ID, block[chars[to-1].item].ID, name, value)
+}
+
+// Spans returns the string split in runs of chars with the same formatting attributes.
+//
+// Time complexity: O(log(atoms) + block size)
+func (s *String) Spans() []Span {
+	block := s.block()
+	chars := stringChars(block)
+	order := make([]int, len(chars))
+	for i, char := range chars {
+		order[i] = char.item
+	}
+	return s.tree.spans(block, order)
+}
+
+// Inserts a mark from the start to the end atom, inclusive.
+func (t *CausalTree) format(start, end AtomID, name string, value interface{}) error {
+	if value != nil {
+		var err error
+		if value, err = scalarValue(value); err != nil {
+			return err
+		}
+	}
+	if err := t.getAtom(start).Value.ValidateChild(MarkStart{}); err != nil {
+		return err
+	}
+	if err := t.getAtom(end).Value.ValidateChild(MarkEnd{}); err != nil {
+		return err
+	}
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	if _, err := t.addAtomAt(start, MarkStart{name, value}); err != nil {
+		return err
+	}
+	_, err := t.addAtomAt(end, MarkEnd{})
+	return err
+}
+
+// Returns the anchor of the MarkEnd following a MarkStart, or false if it's not present.
+//
+// Time complexity: O(1)
+func (t *CausalTree) markEnd(start AtomID) (AtomID, bool) {
+	yarn := t.Yarns[start.Site]
+	i := int(start.Index) + 1
+	if i >= len(yarn) {
+		return AtomID{}, false
+	}
+	if _, ok := yarn[i].Value.(MarkEnd); !ok {
+		return AtomID{}, false
+	}
+	return yarn[i].Cause, true
+}
+
+// Mark applying to a range of atoms.
+type mark struct {
+	id    AtomID
+	end   AtomID
+	name  string
+	value interface{}
+}
+
+// Splits the atoms at the given indices in spans with the same attributes, considering the marks
+// within atoms. Marks apply to atoms in their weave order, and spans follow the given order.
+//
+// Time complexity: O(len(atoms) * (active marks))
+func (t *CausalTree) spans(atoms []weaveAtom, order []int) []Span {
+	// Index marks by their start and end anchors.
+	starts := make(map[AtomID][]mark)
+	ends := make(map[AtomID][]AtomID)
+	for _, atom := range atoms {
+		value, ok := atom.Value.(MarkStart)
+		if !ok || !atom.isLive() {
+			continue
+		}
+		end, ok := t.markEnd(atom.ID)
+		if !ok {
+			continue
+		}
+		starts[atom.Cause] = append(starts[atom.Cause], mark{atom.ID, end, value.Name, value.Value})
+		ends[end] = append(ends[end], atom.ID)
+	}
+	atomAttrs := make([]map[string]interface{}, len(atoms))
+	var attrs map[string]interface{}
+	active := make(map[AtomID]mark)
+	isEndPassed := make(map[AtomID]bool)
+	for i, atom := range atoms {
+		if marks, ok := starts[atom.ID]; ok {
+			for _, m := range marks {
+				if !isEndPassed[m.end] {
+					active[m.id] = m
+				}
+			}
+			attrs = activeAttrs(active)
+		}
+		atomAttrs[i] = attrs
+		if markIDs, ok := ends[atom.ID]; ok {
+			for _, id := range markIDs {
+				delete(active, id)
+			}
+			isEndPassed[atom.ID] = true
+			attrs = activeAttrs(active)
+		}
+	}
+	var spans []Span
+	var text []Atom
+	var textAttrs map[string]interface{}
+	for _, i := range order {
+		if len(text) > 0 && !equalAttrs(atomAttrs[i], textAttrs) {
+			spans = append(spans, Span{atomsToString(text), textAttrs})
+			text = nil
+		}
+		text = append(text, atoms[i].Atom)
+		textAttrs = atomAttrs[i]
+	}
+	if len(text) > 0 {
+		spans = append(spans, Span{atomsToString(text), textAttrs})
+	}
+	return spans
+}
+
+// Returns the attributes of the greatest active mark for each name, or nil if there's none.
+func activeAttrs(active map[AtomID]mark) map[string]interface{} {
+	winners := make(map[string]mark)
+	for _, m := range active {
+		if w, ok := winners[m.name]; !ok || m.id.Compare(w.id) > 0 {
+			winners[m.name] = m
+		}
+	}
+	var attrs map[string]interface{}
+	for name, m := range winners {
+		if m.value == nil {
+			continue
+		}
+		if attrs == nil {
+			attrs = make(map[string]interface{})
+		}
+		attrs[name] = m.value
+	}
+	return attrs
+}
+
+func equalAttrs(a, b map[string]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, x := range a {
+		if y, ok := b[name]; !ok || x != y {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+type attrs = map[string]interface{}
+
+func TestFormat(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertString("hello world", -1); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		f    func() error
+		want []crdt.Span
+	}{
+		{func() error { return tree.Format(0, 5, "bold", true) }, []crdt.Span{
+			{"hello", attrs{"bold": true}},
+			{" world", nil},
+		}},
+		{func() error { return tree.Format(3, 8, "italic", true) }, []crdt.Span{
+			{"hel", attrs{"bold": true}},
+			{"lo", attrs{"bold": true, "italic": true}},
+			{" wo", attrs{"italic": true}},
+			{"rld", nil},
+		}},
+		// Text inserted within a mark is formatted, but not at its boundaries.
+		{func() error { return tree.InsertString("X", 1) }, []crdt.Span{
+			{"heXl", attrs{"bold": true}},
+			{"lo", attrs{"bold": true, "italic": true}},
+			{" wo", attrs{"italic": true}},
+			{"rld", nil},
+		}},
+		{func() error { return tree.InsertString("<", -1) }, []crdt.Span{
+			{"<", nil},
+			{"heXl", attrs{"bold": true}},
+			{"lo", attrs{"bold": true, "italic": true}},
+			{" wo", attrs{"italic": true}},
+			{"rld", nil},
+		}},
+		{func() error { return tree.InsertString(">", 9) }, []crdt.Span{
+			{"<", nil},
+			{"heXl", attrs{"bold": true}},
+			{"lo", attrs{"bold": true, "italic": true}},
+			{" wo", attrs{"italic": true}},
+			{">rld", nil},
+		}},
+		// Newer marks win, and nil removes an attribute.
+		{func() error { return tree.Format(2, 7, "bold", nil) }, []crdt.Span{
+			{"<", nil},
+			{"h", attrs{"bold": true}},
+			{"eXl", nil},
+			{"lo wo", attrs{"italic": true}},
+			{">rld", nil},
+		}},
+		{func() error { return tree.Undo() }, []crdt.Span{
+			{"<", nil},
+			{"heXl", attrs{"bold": true}},
+			{"lo", attrs{"bold": true, "italic": true}},
+			{" wo", attrs{"italic": true}},
+			{">rld", nil},
+		}},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		spans := tree.Spans()
+		if diff := cmp.Diff(step.want, spans); diff != "" {
+			t.Fatalf("step #%d: (-want, +got):\n%s", i, diff)
+		}
+		var text string
+		for _, span := range spans {
+			text += span.Text
+		}
+		if s := tree.ToString(); text != s {
+			t.Errorf("step #%d: spans text is %q, want %q", i, text, s)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.InsertCounter(); err != nil {
+		t.Fatal(err)
+	}
+	want := tree.Clone()
+	for _, r := range [][2]int{{-1, 2}, {2, 1}, {0, 6}} {
+		if err := tree.Format(r[0], r[1], "bold", true); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+			t.Errorf("Format(%d, %d): got err %v, want %v", r[0], r[1], err, crdt.ErrCursorOutOfRange)
+		}
+	}
+	if err := tree.Format(1, 3, "bold", []int{1}); !errors.Is(err, crdt.ErrInvalidScalar) {
+		t.Errorf("Format with slice: got err %v, want %v", err, crdt.ErrInvalidScalar)
+	}
+	// Marks must be anchored at chars, and the counter is at position 0.
+	if err := tree.Format(0, 2, "bold", true); err == nil {
+		t.Errorf("Format(0, 2): got nil err")
+	}
+	if diff := cmp.Diff(want, tree, treeOpts); diff != "" {
+		t.Errorf("tree changed after errors (-want, +got):\n%s", diff)
+	}
+}
+
+func TestFormatConcurrent(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if err := t0.InsertString("abcdefgh", -1); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Overlapping marks with different attributes are both applied.
+	if err := t0.Format(0, 4, "bold", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Format(2, 6, "italic", true); err != nil {
+		t.Fatal(err)
+	}
+	// Chars inserted concurrently within a mark are formatted.
+	if err := t1.InsertString("X", 0); err != nil {
+		t.Fatal(err)
+	}
+	// Overlapping marks with the same attribute are resolved for each char. t1 made one more
+	// operation, so its link is newer.
+	if err := t0.Format(1, 5, "link", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Format(4, 9, "link", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	want := []crdt.Span{
+		{"aX", attrs{"bold": true}},
+		{"b", attrs{"bold": true, "link": "a"}},
+		{"c", attrs{"bold": true, "italic": true, "link": "a"}},
+		{"d", attrs{"bold": true, "italic": true, "link": "b"}},
+		{"ef", attrs{"italic": true, "link": "b"}},
+		{"gh", attrs{"link": "b"}},
+	}
+	for i, tree := range []*crdt.CausalTree{t0, t1} {
+		if diff := cmp.Diff(want, tree.Spans()); diff != "" {
+			t.Errorf("t%d: (-want, +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestStringFormat(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	l, err := tree.SetList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := l.Cursor().Insert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := e.SetString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.Cursor()
+	for _, ch := range "title" {
+		if err := c.Insert(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Format(1, 3, "size", 1.5); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if err := s.Format(0, 6, "size", 2); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+		t.Errorf("Format(0, 6): got err %v, want %v", err, crdt.ErrCursorOutOfRange)
+	}
+	want := []crdt.Span{
+		{"t", nil},
+		{"it", attrs{"size": 1.5}},
+		{"le", nil},
+	}
+	if diff := cmp.Diff(want, s.Spans()); diff != "" {
+		t.Errorf("Spans (-want, +got):\n%s", diff)
+	}
+
+	// Marks survive encoding.
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got := new(crdt.CausalTree)
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if diff := cmp.Diff(tree.Spans(), got.Spans()); diff != "" {
+		t.Errorf("binary round-trip (-want, +got):\n%s", diff)
+	}
+	data, err = json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got = new(crdt.CausalTree)
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(tree.Spans(), got.Spans()); diff != "" {
+		t.Errorf("JSON round-trip (-want, +got):\n%s", diff)
+	}
+}
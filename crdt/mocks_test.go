@@ -22,17 +22,25 @@ func (t *CausalTree) Clone() *CausalTree {
 	n := len(t.Sitemap)
 	remote := &CausalTree{
 		Weave:     make([]Atom, len(t.Weave)),
+		weave:     t.weave.clone(),
+		horizon:   t.Horizon(),
+		history:   t.history.clone(),
 		Cursor:    t.Cursor,
 		Yarns:     make([][]Atom, n),
 		Sitemap:   make([]uuid.UUID, n),
 		SiteID:    t.SiteID,
 		Timestamp: t.Timestamp,
 	}
-	copy(remote.Weave, t.Weave)
 	for i, yarn := range t.Yarns {
 		remote.Yarns[i] = make([]Atom, len(yarn))
 		copy(remote.Yarns[i], yarn)
 	}
+	copy(remote.Weave, t.Weave)
 	copy(remote.Sitemap, t.Sitemap)
 	return remote
 }
+
+// SetWeave replaces the weave without checking it, to build corrupt trees.
+func (t *CausalTree) SetWeave(atoms []Atom) {
+	t.setWeave(newWeave(atoms))
+}
@@ -0,0 +1,331 @@
+package crdt
+
+// +-------+
+// | Moves |
+// +-------+
+
+/*
+Chars in a String and elements in a List may be moved without deleting and re-inserting them, so
+that concurrent moves of the same item never duplicate it. A move is made of two atoms: a MoveFrom
+anchored at the moved item, and a MoveTo at its new position, created one after the other by the
+same site. The MoveTo is placed in the sequence like an inserted item, and the item is shown there
+instead of its original position.
+
+  # BEGIN ASCII ART
+
+  List <- Elem(a) <- Elem(b) <- Elem(c) <- MoveTo
+            ^                                ^
+            '-- MoveFrom ....................'
+
+  # END ASCII ART
+  # ALT TEXT: List with three elements a, b and c, chained one after the other. The first element
+              has a MoveFrom child, paired with a MoveTo child of the last element, so the list
+              is represented as [b, c, a].
+
+If an item is moved concurrently by many sites, the greatest MoveFrom by AtomID.Compare wins, and
+the item is shown only at the position of its MoveTo. Items inserted after a moved item are caused
+by its MoveTo, so they follow it when it's shown elsewhere.
+
+All views of the tree show moved items at their new position, including ToString and tree
+positions, where moved list elements carry their values along. Formatting marks, however, apply
+to chars in their original order.
+*/
+
+// Position of a visible item in a sequence, as indices within its container's block. An item is
+// shown at its own place, unless it's moved to the place of a MoveTo atom.
+type seqItem struct {
+	place, item int
+}
+
+// Returns the visible items within a container's block, in the order they are shown, with the
+// atoms heading containers skipped together with their blocks.
+//
+// Time complexity: O(block size)
+func sequence(block []weaveAtom, isItem func(AtomValue) bool) []seqItem {
+	indices := make(map[AtomID]int)
+	targets := make(map[yarnPosition]int)
+	for j, atom := range block {
+		indices[atom.ID] = j
+		if _, ok := atom.Value.(MoveTo); ok {
+			targets[atom.ID.yarnPosition()] = j
+		}
+	}
+	// Find the winning move of each item, and the item moved to each MoveTo.
+	moves := make(map[int]int)
+	for j, atom := range block {
+		if _, ok := atom.Value.(MoveFrom); !ok || !atom.isLive() {
+			continue
+		}
+		item, ok := indices[atom.Cause]
+		if !ok {
+			continue
+		}
+		if _, ok := targets[yarnPosition{atom.ID.Site, atom.ID.Index + 1}]; !ok {
+			continue
+		}
+		if k, ok := moves[item]; !ok || atom.ID.Compare(block[k].ID) > 0 {
+			moves[item] = j
+		}
+	}
+	moved := make(map[int]int, len(moves))
+	for item, j := range moves {
+		moved[targets[yarnPosition{block[j].ID.Site, block[j].ID.Index + 1}]] = item
+	}
+	var items []seqItem
+	for j := 1; j < len(block); {
+		atom := block[j]
+		switch {
+		case isContainer(atom.Atom):
+			j += weaveBlockSize(block, j)
+			continue
+		case isItem(atom.Value):
+			if _, ok := moves[j]; !ok && atom.isVisible() {
+				items = append(items, seqItem{j, j})
+			}
+		default:
+			if item, ok := moved[j]; ok && block[item].isVisible() {
+				items = append(items, seqItem{j, item})
+			}
+		}
+		j++
+	}
+	return items
+}
+
+// Returns the visible atoms of a weave in the order they are shown, as weave indices, together
+// with the index of the atom at each one's place, which causes the atoms inserted after it. Moved
+// items are shown at the place of their winning move, as in sequence, and moved list elements
+// carry their values along.
+//
+// It also returns the position of each atom in this order, or, for atoms that are not shown, the
+// position of the last atom shown before them.
+//
+// Time complexity: O(atoms)
+func flatOrder(atoms []weaveAtom) (order, places, positions []int) {
+	var indices atomPositions
+	targets := make(map[yarnPosition]int)
+	for j, atom := range atoms {
+		indices.set(atom.ID, j)
+		if _, ok := atom.Value.(MoveTo); ok {
+			targets[atom.ID.yarnPosition()] = j
+		}
+	}
+	// Find the winning move of each item, and the item moved to each MoveTo.
+	moves := make(map[int]int)
+	for j, atom := range atoms {
+		if _, ok := atom.Value.(MoveFrom); !ok || !atom.isLive() {
+			continue
+		}
+		item := indices.get(atom.Cause)
+		if item < 0 {
+			continue
+		}
+		if _, ok := targets[yarnPosition{atom.ID.Site, atom.ID.Index + 1}]; !ok {
+			continue
+		}
+		if k, ok := moves[item]; !ok || atom.ID.Compare(atoms[k].ID) > 0 {
+			moves[item] = j
+		}
+	}
+	moved := make(map[int]int, len(moves))
+	for item, j := range moves {
+		moved[targets[yarnPosition{atoms[j].ID.Site, atoms[j].ID.Index + 1}]] = item
+	}
+	positions = make([]int, len(atoms))
+	isWalked := make([]bool, len(atoms))
+	var walk func(start, end int)
+	walk = func(start, end int) {
+		for j := start; j < end; j++ {
+			if _, ok := moves[j]; ok {
+				// Item is shown at its place. If its place is not walked, it collapses here.
+				k := itemEnd(atoms, j)
+				for ; j < k; j++ {
+					if !isWalked[j] {
+						positions[j] = len(order) - 1
+					}
+				}
+				j--
+				continue
+			}
+			if item, ok := moved[j]; ok {
+				if atoms[item].isVisible() {
+					order = append(order, item)
+					places = append(places, j)
+				}
+				// The place has the item's position, even if its value is shown after it.
+				positions[item], isWalked[item] = len(order)-1, true
+				positions[j], isWalked[j] = len(order)-1, true
+				walk(item+1, itemEnd(atoms, item))
+				continue
+			}
+			if atoms[j].isVisible() {
+				order = append(order, j)
+				places = append(places, j)
+			}
+			positions[j], isWalked[j] = len(order)-1, true
+		}
+	}
+	walk(0, len(atoms))
+	return order, places, positions
+}
+
+// Returns the index after the atoms that move together with the i-th atom, that is, the atom
+// itself and, for list elements, their values.
+//
+// Time complexity: O(value size)
+func itemEnd(atoms []weaveAtom, i int) int {
+	if _, ok := atoms[i].Value.(InsertElem); !ok {
+		return i + 1
+	}
+	j := i + 1
+	for j < len(atoms) && atoms[j].Cause == atoms[i].ID {
+		switch {
+		case atoms[j].Value == Delete{}:
+			j++
+		case isContainer(atoms[j].Atom):
+			j += weaveBlockSize(atoms, j)
+		default:
+			return j
+		}
+	}
+	return j
+}
+
+// Returns the index of the item placed at an atom, or -1 if it's not found.
+func findPlace(block []weaveAtom, items []seqItem, atomID AtomID) int {
+	for i, item := range items {
+		if block[item.place].ID == atomID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Moves the items in the range [from, to) after the at-th item, or to the beginning if at = -1.
+//
+// Time complexity: O((to - from) * (log(atoms) + (avg. block size) + log(sites)))
+func (t *CausalTree) move(block []weaveAtom, items []seqItem, from, to, at int) error {
+	if from < 0 || to < from || to > len(items) || at < -1 || at >= len(items) {
+		return ErrCursorOutOfRange
+	}
+	if at >= from && at < to {
+		return ErrInvalidMove
+	}
+	if from == to || at == from-1 {
+		// Already in place.
+		return nil
+	}
+	dest := block[0].ID
+	if at >= 0 {
+		dest = block[items[at].place].ID
+	}
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	for _, item := range items[from:to] {
+		if _, err := t.addAtomAt(block[item.item].ID, MoveFrom{}); err != nil {
+			return err
+		}
+		var err error
+		if dest, err = t.addAtomAt(dest, MoveTo{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the atom moved to a MoveTo, or the atom itself if it's not a MoveTo.
+//
+// Time complexity: O(log(atoms) + log(sites))
+func (t *CausalTree) movedAtom(atomID AtomID) AtomID {
+	if atomID.Timestamp == 0 {
+		return atomID
+	}
+	if _, ok := t.getAtom(atomID).Value.(MoveTo); !ok || atomID.Index == 0 {
+		return atomID
+	}
+	from := t.Yarns[atomID.Site][atomID.Index-1]
+	if _, ok := from.Value.(MoveFrom); !ok {
+		return atomID
+	}
+	return from.Cause
+}
+
+// Returns the MoveFrom and MoveTo of an atom's winning move, or false if it wasn't moved.
+//
+// Time complexity: O(log(atoms) + block size)
+func (t *CausalTree) winningMove(atomID AtomID) (AtomID, AtomID, bool) {
+	var from, to AtomID
+	var isMoved bool
+	for _, atom := range t.weave.block(atomID) {
+		if _, ok := atom.Value.(MoveFrom); !ok || atom.Cause != atomID || !atom.isLive() {
+			continue
+		}
+		yarn := t.Yarns[atom.ID.Site]
+		i := int(atom.ID.Index) + 1
+		if i >= len(yarn) {
+			continue
+		}
+		if _, ok := yarn[i].Value.(MoveTo); !ok {
+			continue
+		}
+		if !isMoved || atom.ID.Compare(from) > 0 {
+			from, to, isMoved = atom.ID, yarn[i].ID, true
+		}
+	}
+	return from, to, isMoved
+}
+
+// Moves a restored copy of an atom to the position of the atom's winning move, if any. The new
+// move is recorded as a copy of the winning one, so that reverting it reverts the copy instead.
+func (t *CausalTree) restoreMove(atomID, copyID AtomID) error {
+	from, to, ok := t.winningMove(atomID)
+	if !ok {
+		return nil
+	}
+	fromCopy, err := t.addAtomAt(copyID, MoveFrom{})
+	if err != nil {
+		return err
+	}
+	toCopy, err := t.addAtomAt(to, MoveTo{})
+	if err != nil {
+		return err
+	}
+	t.history.setCopy(from, fromCopy)
+	t.history.setCopy(to, toCopy)
+	return nil
+}
+
+// Move moves the element at index i after the element at index at, or to the beginning if
+// at = -1.
+//
+// Returns ErrInvalidMove if i = at.
+//
+// Time complexity: O(log(atoms) + block size + log(sites))
+func (l *List) Move(i, at int) error {
+	block := l.block()
+	return l.tree.move(block, listElems(block), i, i+1, at)
+}
+
+// Move moves the chars in the range [from, to), like a paragraph, after the char at index at, or
+// to the beginning if at = -1. The chars keep their order and formatting.
+//
+// Returns ErrInvalidMove if at is within the range.
+//
+// Time complexity: O((to - from) * (log(atoms) + block size + log(sites)))
+func (s *String) Move(from, to, at int) error {
+	block := s.block()
+	return s.tree.move(block, stringChars(block), from, to, at)
+}
+
+// Move moves the chars at the root of the tree, outside of any container, in the range [from, to)
+// after the char at index at, or to the beginning if at = -1. See String.Move.
+//
+// Indices only count chars at the root, so they are equal to tree positions if the tree has no
+// containers.
+//
+// Time complexity: O(atoms + (to - from) * (log(atoms) + (avg. block size) + log(sites)))
+func (t *CausalTree) Move(from, to, at int) error {
+	// The root's block is the whole weave, headed by the root atom.
+	block := append([]weaveAtom{{}}, t.weave.weaveAtoms()...)
+	return t.move(block, sequence(block, isChar), from, to, at)
+}
@@ -0,0 +1,417 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Builds a list with the given strings as elements.
+func setupStringList(t *testing.T, xs ...string) (*crdt.CausalTree, *crdt.List) {
+	tree := crdt.NewCausalTree()
+	l, err := tree.SetList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := l.Cursor()
+	for _, x := range xs {
+		e, err := c.Insert()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := e.SetString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := s.Cursor()
+		for _, ch := range x {
+			if err := sc.Insert(ch); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return tree, l
+}
+
+// Builds a string with the given contents as the tree's value.
+func setupString(t *testing.T, text string) (*crdt.CausalTree, *crdt.String) {
+	tree := crdt.NewCausalTree()
+	s, err := tree.SetString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.Cursor()
+	for _, ch := range text {
+		if err := c.Insert(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree, s
+}
+
+func TestListMove(t *testing.T) {
+	tree, l := setupStringList(t, "a", "b", "c")
+	c := l.Cursor()
+	tests := []struct {
+		f    func() error
+		want []interface{}
+	}{
+		{func() error { return l.Move(0, 2) }, []interface{}{"b", "c", "a"}},
+		{func() error { return l.Move(2, -1) }, []interface{}{"a", "b", "c"}},
+		{func() error { return l.Move(1, 2) }, []interface{}{"a", "c", "b"}},
+		// Insert after the moved element, at its new position.
+		{func() error {
+			if err := c.Index(2); err != nil {
+				return err
+			}
+			e, err := c.Insert()
+			if err != nil {
+				return err
+			}
+			_, err = e.SetCounter()
+			return err
+		}, []interface{}{"a", "c", "b", int32(0)}},
+		{func() error { return l.Move(2, 0) }, []interface{}{"a", "b", "c", int32(0)}},
+		{tree.Undo, []interface{}{"a", "c", "b", int32(0)}},
+		// Delete the moved element, then restore it at its new position.
+		{func() error {
+			if err := c.Index(2); err != nil {
+				return err
+			}
+			e, err := c.Element()
+			if err != nil {
+				return err
+			}
+			if s := e.Value().(*crdt.String).Snapshot(); s != "b" {
+				return errors.New("cursor is at " + s)
+			}
+			return c.Delete()
+		}, []interface{}{"a", "c", int32(0)}},
+		{tree.Undo, []interface{}{"a", "c", "b", int32(0)}},
+		{tree.Undo, []interface{}{"a", "c", "b", nil}},
+		{tree.Undo, []interface{}{"a", "c", "b"}},
+		{tree.Undo, []interface{}{"a", "b", "c"}},
+		{tree.Redo, []interface{}{"a", "c", "b"}},
+	}
+	for i, test := range tests {
+		if err := test.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if diff := cmp.Diff(test.want, l.Snapshot()); diff != "" {
+			t.Errorf("step #%d (-want, +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestMoveErrors(t *testing.T) {
+	_, l := setupStringList(t, "a", "b", "c")
+	if err := l.Move(1, 1); !errors.Is(err, crdt.ErrInvalidMove) {
+		t.Errorf("Move(1, 1): got err %v, want %v", err, crdt.ErrInvalidMove)
+	}
+	if err := l.Move(3, 0); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+		t.Errorf("Move(3, 0): got err %v, want %v", err, crdt.ErrCursorOutOfRange)
+	}
+	_, s := setupString(t, "abcd")
+	if err := s.Move(1, 3, 2); !errors.Is(err, crdt.ErrInvalidMove) {
+		t.Errorf("Move(1, 3, 2): got err %v, want %v", err, crdt.ErrInvalidMove)
+	}
+	if err := s.Move(1, 3, 4); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+		t.Errorf("Move(1, 3, 4): got err %v, want %v", err, crdt.ErrCursorOutOfRange)
+	}
+	// Moving in place is a no-op.
+	if err := s.Move(1, 3, 0); err != nil {
+		t.Errorf("Move(1, 3, 0): %v", err)
+	}
+	if got := s.Snapshot(); got != "abcd" {
+		t.Errorf("Snapshot() = %q, want %q", got, "abcd")
+	}
+}
+
+func TestListMoveConcurrent(t *testing.T) {
+	t0, l0 := setupStringList(t, "a", "b", "c", "d")
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1 := t1.Value().(*crdt.List)
+	// Both sites move "a", and t1 first moves "d" after it.
+	if err := l0.Move(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Move(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Move(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]interface{}{"b", "c", "d", "a"}, l0.Snapshot()); diff != "" {
+		t.Errorf("t0 before merge (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]interface{}{"d", "b", "a", "c"}, l1.Snapshot()); diff != "" {
+		t.Errorf("t1 before merge (-want, +got):\n%s", diff)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	// t1's move of "a" is the latest one, so it wins.
+	want := []interface{}{"d", "b", "a", "c"}
+	if diff := cmp.Diff(want, l0.Snapshot()); diff != "" {
+		t.Errorf("t0 (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, l1.Snapshot()); diff != "" {
+		t.Errorf("t1 (-want, +got):\n%s", diff)
+	}
+}
+
+func TestListMoveConcurrentDelete(t *testing.T) {
+	t0, l0 := setupStringList(t, "a", "b", "c")
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1 := t1.Value().(*crdt.List)
+	// t0 moves "a" to the end, while t1 deletes it.
+	if err := l0.Move(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	c1 := l1.Cursor()
+	if err := c1.Index(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c1.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"b", "c"}
+	if diff := cmp.Diff(want, l0.Snapshot()); diff != "" {
+		t.Errorf("t0 (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, l1.Snapshot()); diff != "" {
+		t.Errorf("t1 (-want, +got):\n%s", diff)
+	}
+}
+
+func TestStringMove(t *testing.T) {
+	tree, s := setupString(t, "one\ntwo\nthree\n")
+	if err := s.Format(0, 3, "bold", true); err != nil {
+		t.Fatal(err)
+	}
+	// Move the first paragraph after the second one.
+	if err := s.Move(0, 4, 7); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Snapshot(), "two\none\nthree\n"; got != want {
+		t.Errorf("Snapshot() = %q, want %q", got, want)
+	}
+	wantSpans := []crdt.Span{
+		{"two\n", nil},
+		{"one", attrs{"bold": true}},
+		{"\nthree\n", nil},
+	}
+	if diff := cmp.Diff(wantSpans, s.Spans()); diff != "" {
+		t.Errorf("Spans (-want, +got):\n%s", diff)
+	}
+	// The tree's contents show the moved paragraph too.
+	if got, want := tree.ToString(), "*two\none\nthree\n"; got != want {
+		t.Errorf("ToString() = %q, want %q", got, want)
+	}
+	// Text typed after the moved paragraph follows it.
+	c := s.Cursor()
+	if err := c.Index(7); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range "!\n" {
+		if err := c.Insert(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Move(4, 10, -1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Snapshot(), "one\n!\ntwo\nthree\n"; got != want {
+		t.Errorf("Snapshot() = %q, want %q", got, want)
+	}
+	data, err := tree.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree2 := crdt.NewCausalTree()
+	if err := tree2.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree2.Value().(*crdt.String).Snapshot(), "one\n!\ntwo\nthree\n"; got != want {
+		t.Errorf("decoded Snapshot() = %q, want %q", got, want)
+	}
+}
+
+func TestStringMoveTreePositions(t *testing.T) {
+	tree, s := setupString(t, "abcd")
+	// Tree position 0 is the string container.
+	a, err := tree.AtomAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Move(0, 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	// Flat views show the same order as the string.
+	if got, want := tree.ToString(), "*bcda"; got != want {
+		t.Errorf("ToString() = %q, want %q", got, want)
+	}
+	if got, err := tree.AtomAt(4); err != nil || got != a {
+		t.Errorf("AtomAt(4) = %v, %v, want %v", got, err, a)
+	}
+	if i, ok := tree.IndexOf(a); i != 4 || !ok {
+		t.Errorf("IndexOf(%v) = %d, %t, want 4, true", a, i, ok)
+	}
+	wantSpans := []crdt.Span{{"*bcda", nil}}
+	if diff := cmp.Diff(wantSpans, tree.Spans()); diff != "" {
+		t.Errorf("Spans (-want, +got):\n%s", diff)
+	}
+	if got := tree.Blame(); len(got) != 1 || got[0].Text != "*bcda" {
+		t.Errorf("Blame() = %v, want a single run with %q", got, "*bcda")
+	}
+	// Chars inserted after a moved char follow it.
+	if err := tree.InsertCharAt('x', 4); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Snapshot(), "bcdax"; got != want {
+		t.Errorf("Snapshot() = %q, want %q", got, want)
+	}
+	// Ranges are deleted in the order they are shown.
+	if err := tree.DeleteRange(3, 5); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.ToString(), "*bcx"; got != want {
+		t.Errorf("ToString() = %q, want %q", got, want)
+	}
+	if i, ok := tree.IndexOf(a); i != 2 || ok {
+		t.Errorf("IndexOf(%v) = %d, %t, want 2, false", a, i, ok)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListMoveTreePositions(t *testing.T) {
+	tree, l := setupStringList(t, "a", "b", "c")
+	if err := l.Move(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	// Moved elements carry their values.
+	if got, want := tree.ToString(), "[,*b,*c,*a"; got != want {
+		t.Errorf("ToString() = %q, want %q", got, want)
+	}
+	data, err := tree.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]interface{}{[]interface{}{"b", "c", "a"}}, got); diff != "" {
+		t.Errorf("ToJSON (-want, +got):\n%s", diff)
+	}
+	// Insert into the moved element's string, at the end of the tree.
+	if err := tree.InsertCharAt('x', 9); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]interface{}{"b", "c", "ax"}, l.Snapshot()); diff != "" {
+		t.Errorf("Snapshot (-want, +got):\n%s", diff)
+	}
+	if got, want := tree.ToString(), "[,*b,*c,*ax"; got != want {
+		t.Errorf("ToString() = %q, want %q", got, want)
+	}
+}
+
+func TestStringMoveConcurrent(t *testing.T) {
+	t0, s0 := setupString(t, "a\nb\nc\n")
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1 := t1.Value().(*crdt.String)
+	// Both sites move the first paragraph to different positions, and t0 edits it.
+	if err := s0.Move(0, 2, 5); err != nil {
+		t.Fatal(err)
+	}
+	c0 := s0.Cursor()
+	if err := c0.Index(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := c0.Insert('x'); err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.Move(0, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	got0, got1 := s0.Snapshot(), s1.Snapshot()
+	if got0 != got1 {
+		t.Errorf("sites diverged: %q != %q", got0, got1)
+	}
+	// Each char appears exactly once.
+	for _, ch := range "abcx" {
+		if n := strings.Count(got0, string(ch)); n != 1 {
+			t.Errorf("%q appears %d times in %q", ch, n, got0)
+		}
+	}
+}
+
+func TestTreeMove(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertString("abc\ndef\n", -1); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := tree.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		f    func() error
+		want string
+	}{
+		{func() error { return tree.Move(4, 8, -1) }, "def\nabc\n"},
+		{func() error { return tree.InsertCharAt('!', 2) }, "def!\nabc\n"},
+		{func() error { return tree.Move(0, 1, 8) }, "ef!\nabc\nd"},
+		{func() error { return tree.Undo() }, "def!\nabc\n"},
+		// Concurrent edits follow the moved chars.
+		{func() error { return t1.InsertCharAt('?', 2) }, "def!\nabc\n"},
+		{func() error { return tree.Merge(t1) }, "def!\nabc?\n"},
+		// Deleting at the position of a moved char deletes the char, not its MoveTo.
+		{func() error { return tree.DeleteCharAt(0) }, "ef!\nabc?\n"},
+		{func() error { return tree.Undo() }, "def!\nabc?\n"},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if got := tree.ToString(); got != step.want {
+			t.Fatalf("step #%d: got %q, want %q", i, got, step.want)
+		}
+	}
+	if err := tree.Move(1, 3, 2); !errors.Is(err, crdt.ErrInvalidMove) {
+		t.Errorf("Move(1, 3, 2): got err %v, want %v", err, crdt.ErrInvalidMove)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
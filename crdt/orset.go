@@ -0,0 +1,103 @@
+package crdt
+
+// +---------------------+
+// | Observed-remove set |
+// +---------------------+
+
+// ORSet is a set of scalar values: strings, int64s, bools or float64s.
+//
+// Each addition creates an InsertMember atom, and removing a value deletes all of its members
+// that are visible at this site. A concurrent addition of the same value creates a member that
+// wasn't observed by the removal, so the value remains in the set (add-wins).
+type ORSet struct {
+	treePosition
+}
+
+func (*ORSet) isValue() {}
+
+// Snapshot returns the set's members, in the order they appear in the weave.
+//
+// Time complexity: O(log(atoms) + block size)
+func (s *ORSet) Snapshot() []interface{} {
+	return snapshotSet(s.block())
+}
+
+// Members returns the set's members, in the order they appear in the weave.
+//
+// Time complexity: O(log(atoms) + block size)
+func (s *ORSet) Members() []interface{} {
+	return s.Snapshot()
+}
+
+// Len returns the number of members.
+//
+// Time complexity: O(log(atoms) + block size)
+func (s *ORSet) Len() int {
+	return len(s.Snapshot())
+}
+
+// Contains returns whether the value is a member of the set.
+//
+// Time complexity: O(log(atoms) + block size)
+func (s *ORSet) Contains(x interface{}) bool {
+	value, err := scalarValue(x)
+	if err != nil {
+		return false
+	}
+	return len(setMembers(s.block(), value)) > 0
+}
+
+// Add adds a value to the set. Values of type int are converted to int64, and other types
+// return ErrInvalidScalar.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (s *ORSet) Add(x interface{}) error {
+	value, err := scalarValue(x)
+	if err != nil {
+		return err
+	}
+	_, err = s.tree.addAtomAt(s.atomID(), InsertMember{value})
+	return err
+}
+
+// Remove removes a value from the set, if it's present.
+//
+// Time complexity: O(log(atoms) + block size + (members) * log(sites))
+func (s *ORSet) Remove(x interface{}) error {
+	value, err := scalarValue(x)
+	if err != nil {
+		return err
+	}
+	t := s.tree
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	for _, atomID := range setMembers(s.block(), value) {
+		if _, err := t.addAtomAt(atomID, Delete{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the visible members with the given value within a set's block.
+func setMembers(block []weaveAtom, value interface{}) []AtomID {
+	var atomIDs []AtomID
+	for _, atom := range block {
+		if member, ok := atom.Value.(InsertMember); ok && member.Value == value && atom.isVisible() {
+			atomIDs = append(atomIDs, atom.ID)
+		}
+	}
+	return atomIDs
+}
+
+func snapshotSet(block []weaveAtom) []interface{} {
+	xs := []interface{}{}
+	seen := make(map[interface{}]bool)
+	for _, atom := range block {
+		if member, ok := atom.Value.(InsertMember); ok && atom.isVisible() && !seen[member.Value] {
+			seen[member.Value] = true
+			xs = append(xs, member.Value)
+		}
+	}
+	return xs
+}
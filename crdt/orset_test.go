@@ -0,0 +1,160 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ crdt.Container = (*crdt.ORSet)(nil)
+
+func TestORSet(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	s, err := tree.SetORSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		f    func() error
+		want []interface{}
+	}{
+		{func() error { return s.Add("draft") }, []interface{}{"draft"}},
+		{func() error { return s.Add(7) }, []interface{}{int64(7), "draft"}},
+		// Adding a member again doesn't duplicate it.
+		{func() error { return s.Add("draft") }, []interface{}{"draft", int64(7)}},
+		{func() error { return s.Remove("draft") }, []interface{}{int64(7)}},
+		{func() error { return s.Remove("missing") }, []interface{}{int64(7)}},
+		{func() error { return tree.Undo() }, []interface{}{"draft", int64(7)}},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if diff := cmp.Diff(step.want, s.Members()); diff != "" {
+			t.Fatalf("step #%d: (-want, +got):\n%s", i, diff)
+		}
+	}
+	if !s.Contains("draft") || !s.Contains(7) || s.Contains("missing") {
+		t.Errorf("Contains: wrong membership for %v", s.Members())
+	}
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", s.Len())
+	}
+	if err := s.Add([]string{"x"}); !errors.Is(err, crdt.ErrInvalidScalar) {
+		t.Errorf("Add: got err %v, want %v", err, crdt.ErrInvalidScalar)
+	}
+}
+
+func TestORSetConcurrent(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	s0, err := t0.SetORSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"a", "b", "c"} {
+		if err := s0.Add(tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1 := t1.Value().(*crdt.ORSet)
+	// Concurrent add and remove of "a": add wins.
+	if err := s0.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.Add("a"); err != nil {
+		t.Fatal(err)
+	}
+	// Concurrent removals of "b".
+	if err := s0.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"a", "c"}
+	asSet := cmp.Transformer("asSet", func(xs []interface{}) map[interface{}]bool {
+		m := make(map[interface{}]bool)
+		for _, x := range xs {
+			m[x] = true
+		}
+		return m
+	})
+	for i, s := range []*crdt.ORSet{s0, s1} {
+		if diff := cmp.Diff(want, s.Members(), asSet); diff != "" {
+			t.Errorf("t%d: (-want, +got):\n%s", i, diff)
+		}
+	}
+	if diff := cmp.Diff(s0.Members(), s1.Members()); diff != "" {
+		t.Errorf("diverged (-t0, +t1):\n%s", diff)
+	}
+}
+
+func TestORSetEncoding(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	m, err := tree.SetMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Key("tags").SetORSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []interface{}{"go", false, 2.5} {
+		if err := s.Add(x); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := tree.ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	wantJSON := `[
+    {
+        "tags": [
+            2.5,
+            false,
+            "go"
+        ]
+    }
+]`
+	if string(data) != wantJSON {
+		t.Errorf("ToJSON() = %s, want %s", data, wantJSON)
+	}
+
+	want := tree.Snapshot()
+	data, err = tree.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got := new(crdt.CausalTree)
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if diff := cmp.Diff(want, got.Snapshot()); diff != "" {
+		t.Errorf("binary round-trip (-want, +got):\n%s", diff)
+	}
+	data, err = json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got = new(crdt.CausalTree)
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(want, got.Snapshot()); diff != "" {
+		t.Errorf("JSON round-trip (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,367 @@
+package crdt
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// +--------+
+// | Values |
+// +--------+
+
+/*
+Besides the flat containers inserted with InsertStr and InsertCounter, a tree may hold nested
+values, that are manipulated through handles:
+
+- String: sequence of chars, represented as a string.
+- Counter: mutable integer, represented as an int32.
+- List: sequence of elements, represented as a []interface{}.
+- Map: values indexed by string keys, represented as a map[string]interface{}.
+- LWWRegister: scalar value, represented as a string, int64, bool or float64.
+- ORSet: set of scalar values, represented as a []interface{}.
+
+A Register holds a single value, or none. The tree itself is a register, whose value is the
+latest container inserted under the root, and so is each list element (Elem). Setting a register
+deletes its previous value and inserts a new container as its child. If registers are set
+concurrently, the latest container wins. Setting the tree's value deletes only its current value,
+so that older containers under the root, like the ones inserted with InsertStr and InsertCounter,
+are kept. Deleting a map key or list element buries its value.
+
+  # BEGIN ASCII ART
+
+  root <- List <- Elem <- Elem <- Elem
+           ^       ^       ^       ^
+           |       |       |       '-- Counter <- +1 <- +2
+           |       |       '-- List <- Elem
+           |       '-- String <- a <- b <- c
+           '-- ⌫
+
+  # END ASCII ART
+  # ALT TEXT: Tree with a list as child of the root, with three elements chained one after the other.
+              The first element holds a string "abc", the second holds a list with a single empty
+              element, and the third one holds a counter with value 3. The list is represented
+              as ["abc", [null], 3].
+
+Handles and cursors refer to atoms by their site UUID and yarn index, so they remain valid after
+sites are remapped by Fork and Merge.
+*/
+
+// Errors returned by value handles.
+var (
+	ErrCursorAtHead = errors.New("cursor is at the container's head")
+	ErrInvalidMove  = errors.New("can't move items after one of themselves")
+)
+
+// Value is a structure that may be converted to concrete data. Concrete values have a Snapshot()
+// method that returns the value's Go representation.
+type Value interface {
+	isValue()
+}
+
+// Register contains a single value or none at all.
+type Register interface {
+	// SetString sets the register to an empty string.
+	SetString() (*String, error)
+	// SetCounter sets the register to a zeroed counter.
+	SetCounter() (*Counter, error)
+	// SetList sets the register to an empty list.
+	SetList() (*List, error)
+	// SetMap sets the register to an empty map.
+	SetMap() (*Map, error)
+	// SetRegister sets the register to an empty last-writer-wins register.
+	SetRegister() (*LWWRegister, error)
+	// SetORSet sets the register to an empty observed-remove set.
+	SetORSet() (*ORSet, error)
+	// Clear resets the register to an empty state.
+	Clear() error
+	// Value returns the register's value, or nil if it's empty.
+	Value() Value
+}
+
+// Container is a value that is a collection of other values.
+type Container interface {
+	Value
+	// Len returns the number of elements in the container.
+	Len() int
+}
+
+// +---------------+
+// | Tree position |
+// +---------------+
+
+// Position of an atom within a tree, identified by its site and yarn index, that are stable when
+// sites are remapped. The root atom has a nil site.
+type treePosition struct {
+	tree  *CausalTree
+	site  uuid.UUID
+	index uint32
+}
+
+func (t *CausalTree) positionOf(atomID AtomID) treePosition {
+	if atomID.Timestamp == 0 {
+		return treePosition{tree: t}
+	}
+	return treePosition{t, t.Sitemap[atomID.Site], atomID.Index}
+}
+
+// Returns the atom's ID in the tree.
+//
+// Time complexity: O(log(sites))
+func (p treePosition) atomID() AtomID {
+	if p.site == uuid.Nil {
+		return AtomID{}
+	}
+	t := p.tree
+	return t.Yarns[siteIndex(t.Sitemap, p.site)][p.index].ID
+}
+
+// Returns the atoms in the causal block headed by this atom.
+//
+// Time complexity: O(log(atoms) + block size)
+func (p treePosition) block() []weaveAtom {
+	return p.tree.weave.block(p.atomID())
+}
+
+// Inserts an atom as a child of the given cause, preserving the tree's cursor.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (t *CausalTree) addAtomAt(cause AtomID, value AtomValue) (AtomID, error) {
+	cursor := t.Cursor
+	t.Cursor = cause
+	atomID, err := t.addAtom(value)
+	t.Cursor = cursor
+	t.fixDeletedCursor()
+	return atomID, err
+}
+
+// Returns the atom itself, if it's not deleted, or its first non-deleted ancestor, stopping at
+// the container's head.
+//
+// Time complexity: O(avg. tree height)
+func (t *CausalTree) undeletedWithin(atomID, head AtomID) AtomID {
+	for atomID != head && t.isDeleted(atomID) {
+		atomID = t.getAtom(atomID).Cause
+	}
+	return atomID
+}
+
+// +-----------+
+// | Registers |
+// +-----------+
+
+// A register whose value is a child of the atom at the given position.
+type register struct {
+	treePosition
+}
+
+// Returns the indices of a register's visible values within a block, newest first.
+// The register's children are expected to start at the given index.
+//
+// Time complexity: O(block size)
+func registerValues(block []weaveAtom, head AtomID, start int) []int {
+	var values []int
+	for j := start; j < len(block) && block[j].Cause == head; {
+		switch {
+		case isContainer(block[j].Atom):
+			if block[j].isVisible() {
+				values = append(values, j)
+			}
+			j += weaveBlockSize(block, j)
+		case block[j].Value == Delete{}:
+			j++
+		case head.Timestamp == 0:
+			// Children of the root are sorted by age, so values may come after flat chars.
+			j += weaveBlockSize(block, j)
+		default:
+			// Remaining children have lower priority than values.
+			return values
+		}
+	}
+	return values
+}
+
+// Returns the register's visible values.
+func (r register) values() ([]weaveAtom, []int) {
+	head := r.atomID()
+	block := r.tree.weave.block(head)
+	start := 1
+	if head.Timestamp == 0 {
+		start = 0
+	}
+	return block, registerValues(block, head, start)
+}
+
+func (r register) value() Value {
+	block, values := r.values()
+	if len(values) == 0 {
+		return nil
+	}
+	return r.tree.valueOf(block[values[0]].Atom)
+}
+
+func (r register) clear() error {
+	block, values := r.values()
+	return r.tree.deleteValues(block, values)
+}
+
+// Deletes the values at the given indices of a block.
+func (t *CausalTree) deleteValues(block []weaveAtom, values []int) error {
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	for _, i := range values {
+		if _, err := t.addAtomAt(block[i].ID, Delete{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r register) set(value AtomValue) (treePosition, error) {
+	t := r.tree
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	block, values := r.values()
+	if r.site == uuid.Nil && len(values) > 1 {
+		// The root also holds flat containers, so only its current value is replaced.
+		values = values[:1]
+	}
+	if err := t.deleteValues(block, values); err != nil {
+		return treePosition{}, err
+	}
+	atomID, err := t.addAtomAt(r.atomID(), value)
+	if err != nil {
+		return treePosition{}, err
+	}
+	return t.positionOf(atomID), nil
+}
+
+// Returns a handle for the value represented by an atom.
+func (t *CausalTree) valueOf(atom Atom) Value {
+	p := t.positionOf(atom.ID)
+	switch atom.Value.(type) {
+	case InsertStr:
+		return &String{p}
+	case InsertCounter:
+		return &Counter{p}
+	case InsertList:
+		return &List{p}
+	case InsertMap:
+		return &Map{p}
+	case InsertRegister:
+		return &LWWRegister{p}
+	case InsertSet:
+		return &ORSet{p}
+	}
+	return nil
+}
+
+// Returns the Go representation of the value represented by an atom.
+//
+// Time complexity: O(log(atoms) + block size)
+func (t *CausalTree) snapshotValue(atomID AtomID) interface{} {
+	block := t.weave.block(atomID)
+	if len(block) == 0 {
+		return nil
+	}
+	return snapshotBlock(block[:weaveBlockSize(block, 0)])
+}
+
+// Returns the Go representation of the value heading the block.
+func snapshotBlock(block []weaveAtom) interface{} {
+	switch block[0].Value.(type) {
+	case InsertStr:
+		return snapshotString(block)
+	case InsertCounter:
+		return snapshotCounter(block)
+	case InsertList:
+		return snapshotList(block)
+	case InsertMap:
+		return snapshotMap(block)
+	case InsertRegister:
+		return snapshotRegister(block)
+	case InsertSet:
+		return snapshotSet(block)
+	}
+	return nil
+}
+
+// SetString sets the tree's value to an empty string, replacing its current value.
+func (t *CausalTree) SetString() (*String, error) {
+	p, err := register{treePosition{tree: t}}.set(InsertStr{})
+	if err != nil {
+		return nil, err
+	}
+	return &String{p}, nil
+}
+
+// SetCounter sets the tree's value to a zeroed counter, replacing its current value.
+func (t *CausalTree) SetCounter() (*Counter, error) {
+	p, err := register{treePosition{tree: t}}.set(InsertCounter{})
+	if err != nil {
+		return nil, err
+	}
+	return &Counter{p}, nil
+}
+
+// SetList sets the tree's value to an empty list, replacing its current value.
+func (t *CausalTree) SetList() (*List, error) {
+	p, err := register{treePosition{tree: t}}.set(InsertList{})
+	if err != nil {
+		return nil, err
+	}
+	return &List{p}, nil
+}
+
+// SetMap sets the tree's value to an empty map, replacing its current value.
+func (t *CausalTree) SetMap() (*Map, error) {
+	p, err := register{treePosition{tree: t}}.set(InsertMap{})
+	if err != nil {
+		return nil, err
+	}
+	return &Map{p}, nil
+}
+
+// SetRegister sets the tree's value to an empty last-writer-wins register, replacing its
+// current value.
+func (t *CausalTree) SetRegister() (*LWWRegister, error) {
+	p, err := register{treePosition{tree: t}}.set(InsertRegister{})
+	if err != nil {
+		return nil, err
+	}
+	return &LWWRegister{p}, nil
+}
+
+// SetORSet sets the tree's value to an empty observed-remove set, replacing its current
+// value.
+func (t *CausalTree) SetORSet() (*ORSet, error) {
+	p, err := register{treePosition{tree: t}}.set(InsertSet{})
+	if err != nil {
+		return nil, err
+	}
+	return &ORSet{p}, nil
+}
+
+// Clear deletes all containers under the root.
+func (t *CausalTree) Clear() error {
+	return register{treePosition{tree: t}}.clear()
+}
+
+// Value returns the latest visible container under the root, or nil if there's none.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) Value() Value {
+	return register{treePosition{tree: t}}.value()
+}
+
+// Snapshot returns the Go representation of the tree's value, or nil if it's empty.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) Snapshot() interface{} {
+	block, values := register{treePosition{tree: t}}.values()
+	if len(values) == 0 {
+		return nil
+	}
+	i := values[0]
+	return snapshotBlock(block[i : i+weaveBlockSize(block, i)])
+}
@@ -0,0 +1,176 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	_ crdt.Register  = (*crdt.CausalTree)(nil)
+	_ crdt.Register  = (*crdt.Elem)(nil)
+	_ crdt.Container = (*crdt.String)(nil)
+	_ crdt.Container = (*crdt.List)(nil)
+	_ crdt.Value     = (*crdt.Counter)(nil)
+)
+
+func TestTreeRegister(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if v := tree.Value(); v != nil {
+		t.Fatalf("empty tree: got value %v", v)
+	}
+	steps := []struct {
+		f    func() error
+		want interface{}
+	}{
+		{func() error {
+			s, err := tree.SetString()
+			if err != nil {
+				return err
+			}
+			c := s.Cursor()
+			for _, ch := range "hi" {
+				if err := c.Insert(ch); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, "hi"},
+		{func() error {
+			cnt, err := tree.SetCounter()
+			if err != nil {
+				return err
+			}
+			if err := cnt.Increment(10); err != nil {
+				return err
+			}
+			return cnt.Decrement(3)
+		}, int32(7)},
+		{func() error { return tree.Clear() }, nil},
+		{func() error { return tree.Undo() }, int32(7)},
+		{func() error { return tree.Undo() }, int32(10)},
+		{func() error { return tree.Undo() }, int32(0)},
+		// Setting the register is undone at once.
+		{func() error { return tree.Undo() }, "hi"},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if diff := cmp.Diff(step.want, tree.Snapshot()); diff != "" {
+			t.Fatalf("step #%d: (-want, +got):\n%s", i, diff)
+		}
+	}
+	if _, ok := tree.Value().(*crdt.String); !ok {
+		t.Errorf("got value %T, want *crdt.String", tree.Value())
+	}
+}
+
+func TestTreeRegisterConcurrent(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if _, err := t0.SetString(); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := t0.SetList(); err != nil {
+		t.Fatal(err)
+	}
+	// t1 sets the register twice, so that its counter is newer than t0's list.
+	if _, err := t1.SetString(); err != nil {
+		t.Fatal(err)
+	}
+	cnt, err := t1.SetCounter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cnt.Increment(1); err != nil {
+		t.Fatal(err)
+	}
+	// The latest value wins.
+	if err := t0.Merge(t1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatal(err)
+	}
+	for i, tree := range []*crdt.CausalTree{t0, t1} {
+		if diff := cmp.Diff(int32(1), tree.Snapshot()); diff != "" {
+			t.Errorf("t%d: (-want, +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestTreeRegisterKeepsFlatContainers(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	steps := []func() error{
+		tree.InsertStr,
+		func() error { return tree.InsertChar('a') },
+		func() error { return tree.InsertChar('b') },
+		tree.InsertCounter,
+		func() error { _, err := tree.SetMap(); return err },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+	}
+	// Setting the map replaces only the counter, which was the tree's value, and keeps the string.
+	containers := tree.Containers()
+	if len(containers) != 2 {
+		t.Fatalf("got %d containers, want 2", len(containers))
+	}
+	if _, ok := containers[0].(*crdt.Map); !ok {
+		t.Errorf("containers[0] is %T, want *crdt.Map", containers[0])
+	}
+	s, ok := containers[1].(*crdt.StrContainer)
+	if !ok {
+		t.Fatalf("containers[1] is %T, want *crdt.StrContainer", containers[1])
+	}
+	if got := s.Snapshot(); got != "ab" {
+		t.Errorf("s.Snapshot() = %q, want %q", got, "ab")
+	}
+}
+
+func TestTreeRegisterAfterFlatChars(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	s, err := tree.SetString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cursor().Insert('h'); err != nil {
+		t.Fatal(err)
+	}
+	// A char at the root is newer than the string, and comes before it in the weave.
+	if err := tree.InsertCharAt('x', -1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.Snapshot(), "h"; got != want {
+		t.Errorf("Snapshot() = %#v, want %#v", got, want)
+	}
+	if _, ok := tree.Value().(*crdt.String); !ok {
+		t.Errorf("Value() is %T, want *crdt.String", tree.Value())
+	}
+	// Setting a counter replaces the string, and keeps the flat char.
+	if _, err := tree.SetCounter(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := tree.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]interface{}{0.0, "x"}, got); diff != "" {
+		t.Errorf("ToJSON (-want, +got):\n%s", diff)
+	}
+	if got, want := tree.Snapshot(), int32(0); got != want {
+		t.Errorf("Snapshot() = %#v, want %#v", got, want)
+	}
+}
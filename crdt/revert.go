@@ -0,0 +1,71 @@
+package crdt
+
+import (
+	"github.com/google/uuid"
+)
+
+// +------------------+
+// | Selective revert |
+// +------------------+
+
+// RevertSite reverts every atom created by a site after the given weft: inserted atoms are
+// deleted, InsertAdd atoms are negated, and atoms deleted by the site are restored as in Undo.
+//
+// Atoms from other sites are kept, even if they were inserted after a reverted atom, and atoms
+// also deleted by other sites are not restored. Containers created by the site are kept if they
+// hold visible atoms from other sites, since deleting them would hide those atoms. The new atoms
+// are created by this site, so they are merged as any other edit, and they may be undone as a
+// single operation with Undo. The cursor is kept in place, or moved to its closest visible
+// ancestor if it was deleted.
+//
+// Time complexity: O(atoms + (site atoms) * (log(atoms) + avg. block size))
+func (t *CausalTree) RevertSite(siteID uuid.UUID, since Weft) error {
+	limits, err := t.checkWeft(since)
+	if err != nil {
+		return err
+	}
+	i := siteIndex(t.Sitemap, siteID)
+	if i == len(t.Sitemap) || t.Sitemap[i] != siteID {
+		return ErrUnknownSite
+	}
+	cursor := t.Cursor
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	for _, atom := range t.Yarns[i][limits[i]:] {
+		if _, ok := atom.Value.(Delete); ok {
+			// Atoms inserted by the site after the weft stay deleted.
+			if limits.isInView(atom.Cause) || int(atom.Cause.Site) != i {
+				if err := t.restore(atom.Cause, atom.ID.Site); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if isContainer(atom) && t.hasVisibleDescendantFromOtherSite(atom.ID) {
+			continue
+		}
+		if err := t.revertInsert(atom.ID); err != nil {
+			return err
+		}
+	}
+	t.Cursor = cursor
+	t.fixDeletedCursor()
+	return nil
+}
+
+// Returns whether the atom has a visible descendant created by another site.
+//
+// Time complexity: O(log(atoms) + avg. block size)
+func (t *CausalTree) hasVisibleDescendantFromOtherSite(atomID AtomID) bool {
+	var found bool
+	t.weave.iterate(t.atomIndex(atomID)+1, func(leaf *weaveNode, i int) bool {
+		atom := leaf.atoms[i]
+		if atom.Cause.Timestamp < atomID.Timestamp {
+			// End of causal block.
+			return false
+		}
+		found = atom.ID.Site != atomID.Site && atom.isVisible()
+		return !found
+	})
+	return found
+}
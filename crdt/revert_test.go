@@ -0,0 +1,177 @@
+package crdt_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/uuid"
+)
+
+func TestRevertSite(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := testOperations(t, []operation{
+		{op: insertChar, local: 0, char: 'h'},
+		{op: insertChar, local: 0, char: 'e'},
+		{op: insertChar, local: 0, char: 'l'},
+		{op: insertChar, local: 0, char: 'l'},
+		{op: insertChar, local: 0, char: 'o'},
+		{op: fork, local: 0, remote: 1},
+	})
+	t0, t1 := trees[0], trees[1]
+	since := t0.Now()
+	steps := []func() error{
+		func() error { return t1.InsertCharAt('X', 1) },
+		func() error { return t1.InsertChar('Y') },
+		func() error { return t1.InsertCharAt('Z', 6) },
+		func() error { return t1.DeleteCharAt(3) },
+		func() error { return t1.DeleteCharAt(0) },
+		func() error { return t0.InsertCharAt('!', -1) },
+		func() error { return t0.Merge(t1) },
+		func() error { return t0.InsertCharAt('W', 2) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+	}
+	if s := t0.ToString(); s != "!eXWlloZ" {
+		t.Fatalf("got %q, want %q", s, "!eXWlloZ")
+	}
+	if err := t0.RevertSite(t1.SiteID, since); err != nil {
+		t.Fatalf("RevertSite: %v", err)
+	}
+	// Deletion of 'h' is reverted, 'Y' stays deleted, and 'W' is kept.
+	if s := t0.ToString(); s != "!heWllo" {
+		t.Errorf("got %q, want %q", s, "!heWllo")
+	}
+	if err := t1.Merge(t0); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if s := t1.ToString(); s != "!heWllo" {
+		t.Errorf("got %q, want %q", s, "!heWllo")
+	}
+	// Revert is undone as a single operation.
+	if err := t0.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if s := t0.ToString(); s != "!eXWlloZ" {
+		t.Errorf("got %q, want %q", s, "!eXWlloZ")
+	}
+}
+
+func TestRevertSiteDeletions(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000003-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	t0 := crdt.NewCausalTree()
+	if err := t0.InsertString("hello world", -1); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := t0.Now()
+	steps := []func() error{
+		// t2 deletes "world" concurrently with t1 deleting the whole text.
+		func() error { return t2.DeleteRange(5, 11) },
+		func() error { return t1.DeleteRange(0, 11) },
+		func() error { return t0.Merge(t1) },
+		func() error { return t0.Merge(t2) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+	}
+	if s := t0.ToString(); s != "" {
+		t.Fatalf("got %q, want %q", s, "")
+	}
+	if err := t0.RevertSite(t1.SiteID, since); err != nil {
+		t.Fatalf("RevertSite: %v", err)
+	}
+	// Atoms also deleted by t2 are not restored.
+	if s := t0.ToString(); s != "hello" {
+		t.Errorf("got %q, want %q", s, "hello")
+	}
+	if err := t0.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := t0.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if s := t0.ToString(); s != "" {
+		t.Errorf("got %q, want %q", s, "")
+	}
+}
+
+func TestRevertSiteContainers(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := t0.Now()
+	steps := []func() error{
+		t1.InsertStr,
+		func() error { return t1.InsertChar('a') },
+		func() error { return t1.InsertCounter() },
+		func() error { return t1.InsertAdd(1) },
+		func() error { return t0.Merge(t1) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+	}
+	// Insert a char from t0 into t1's string.
+	s, ok := t0.Containers()[1].(*crdt.StrContainer)
+	if !ok {
+		t.Fatalf("containers[1] is %T, want *crdt.StrContainer", t0.Containers()[1])
+	}
+	if err := s.InsertCharAt('b', 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.RevertSite(t1.SiteID, since); err != nil {
+		t.Fatalf("RevertSite: %v", err)
+	}
+	// The string is kept with the char from t0, and the counter is deleted.
+	containers := t0.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers, want 1", len(containers))
+	}
+	s, ok = containers[0].(*crdt.StrContainer)
+	if !ok {
+		t.Fatalf("containers[0] is %T, want *crdt.StrContainer", containers[0])
+	}
+	if got := s.Snapshot(); got != "b" {
+		t.Errorf("s.Snapshot() = %q, want %q", got, "b")
+	}
+}
+
+func TestRevertSiteErrors(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertChar('a'); err != nil {
+		t.Fatalf("InsertChar: %v", err)
+	}
+	if err := tree.RevertSite(uuid.New(), tree.Now()); !errors.Is(err, crdt.ErrUnknownSite) {
+		t.Errorf("got %v, want %v", err, crdt.ErrUnknownSite)
+	}
+	if err := tree.RevertSite(tree.SiteID, crdt.Weft{}); !errors.Is(err, crdt.ErrWeftInvalidLength) {
+		t.Errorf("got %v, want %v", err, crdt.ErrWeftInvalidLength)
+	}
+}
@@ -0,0 +1,120 @@
+package crdt
+
+// +--------------+
+// | String value |
+// +--------------+
+
+// String is a Container of chars, represented as a Go string.
+type String struct {
+	treePosition
+}
+
+func (*String) isValue() {}
+
+// Snapshot returns the string's visible chars.
+//
+// Time complexity: O(log(atoms) + block size)
+func (s *String) Snapshot() string {
+	return snapshotString(s.block())
+}
+
+// Len returns the number of visible chars.
+//
+// Time complexity: O(log(atoms) + block size)
+func (s *String) Len() int {
+	return len(stringChars(s.block()))
+}
+
+// Cursor returns a cursor positioned at the string's head.
+func (s *String) Cursor() *StringCursor {
+	return &StringCursor{head: s.treePosition, pos: s.treePosition}
+}
+
+// Returns the visible chars within a string's block, in order.
+func stringChars(block []weaveAtom) []seqItem {
+	return sequence(block, isChar)
+}
+
+func isChar(value AtomValue) bool {
+	_, ok := value.(InsertChar)
+	return ok
+}
+
+func snapshotString(block []weaveAtom) string {
+	chars := stringChars(block)
+	runes := make([]rune, len(chars))
+	for i, char := range chars {
+		runes[i] = block[char.item].Value.(InsertChar).Char
+	}
+	return string(runes)
+}
+
+// StringCursor walks and modifies a String.
+//
+// Like the tree's Cursor, it holds the position of the causing atom for the next insertion, and
+// it's moved to the closest non-deleted ancestor if its char is deleted by another site.
+type StringCursor struct {
+	head, pos treePosition
+}
+
+// Returns the ID of the cursor's atom, or of its first non-deleted ancestor within the string.
+func (c *StringCursor) atomID() AtomID {
+	return c.pos.tree.undeletedWithin(c.pos.atomID(), c.head.atomID())
+}
+
+// Index moves the cursor to the i-th visible char. Use i = -1 to move it to the string's head,
+// so that chars are inserted at the beginning.
+//
+// Time complexity: O(log(atoms) + block size)
+func (c *StringCursor) Index(i int) error {
+	block := c.head.block()
+	chars := stringChars(block)
+	if i < -1 || i >= len(chars) {
+		return ErrCursorOutOfRange
+	}
+	if i == -1 {
+		c.pos = c.head
+		return nil
+	}
+	c.pos = c.pos.tree.positionOf(block[chars[i].place].ID)
+	return nil
+}
+
+// Insert inserts a char after the cursor, and advances the cursor to it.
+//
+// Time complexity: O(log(atoms) + (avg. block size) + log(sites))
+func (c *StringCursor) Insert(ch rune) error {
+	t := c.pos.tree
+	atomID, err := t.addAtomAt(c.atomID(), InsertChar{ch})
+	if err != nil {
+		return err
+	}
+	c.pos = t.positionOf(atomID)
+	return nil
+}
+
+// Delete deletes the char at the cursor, and moves the cursor to the previous char.
+//
+// Time complexity: O(log(atoms) + block size + log(sites))
+func (c *StringCursor) Delete() error {
+	t := c.pos.tree
+	atomID := c.atomID()
+	if atomID == c.head.atomID() {
+		return ErrCursorAtHead
+	}
+	block := c.head.block()
+	chars := stringChars(block)
+	k := findPlace(block, chars, atomID)
+	if _, err := t.addAtomAt(t.movedAtom(atomID), Delete{}); err != nil {
+		return err
+	}
+	switch {
+	case k > 0:
+		c.pos = t.positionOf(block[chars[k-1].place].ID)
+	case k == 0:
+		c.pos = c.head
+	default:
+		c.pos = t.positionOf(t.undeletedWithin(atomID, c.head.atomID()))
+	}
+	return nil
+}
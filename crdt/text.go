@@ -0,0 +1,188 @@
+package crdt
+
+import (
+	"github.com/brunokim/causal-tree/diff"
+)
+
+// +---------------------------+
+// | Operations - Bulk editing |
+// +---------------------------+
+
+// InsertString inserts a string after the given (tree) position, as a chain of InsertChar atoms,
+// and moves the cursor to its last char.
+//
+// To insert at the beginning, use at = -1.
+//
+// Time complexity: O(len(s) * (log(atoms) + log(sites)))
+func (t *CausalTree) InsertString(s string, at int) error {
+	cursor := t.Cursor
+	if err := t.SetCursor(at); err != nil {
+		return err
+	}
+	if s == "" {
+		return nil
+	}
+	if t.Cursor.Timestamp > 0 {
+		// Validate only the first char, since InsertChar accepts other InsertChar atoms as children.
+		if err := t.getAtom(t.Cursor).Value.ValidateChild(InsertChar{}); err != nil {
+			t.Cursor = cursor
+			return err
+		}
+	}
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	for _, ch := range s {
+		if err := t.InsertChar(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRange deletes atoms from the (tree) positions in the range [from, to), and moves the
+// cursor to the position before the range.
+//
+// Time complexity: O((to - from) * (log(atoms) + log(sites))), plus O(atoms) if some atom was moved
+func (t *CausalTree) DeleteRange(from, to int) error {
+	atoms, err := t.atomsInRange(from, to)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return t.SetCursor(from - 1)
+	}
+	// Check that all atoms in range can be deleted.
+	for _, atom := range atoms {
+		if err := atom.Value.ValidateChild(Delete{}); err != nil {
+			return err
+		}
+	}
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	for _, atom := range atoms {
+		atomID := atom.ID
+		if leaf, i := t.weave.lookup(atomID); !leaf.atoms[i].isVisible() {
+			// Atom was buried by the deletion of its container.
+			continue
+		}
+		t.Cursor = atomID
+		if _, err := t.addAtom(Delete{}); err != nil {
+			return err
+		}
+	}
+	t.fixDeletedCursor()
+	return t.SetCursor(from - 1)
+}
+
+// Returns the atoms from the (tree) positions in the range [from, to).
+//
+// Time complexity: O(log(atoms) + (to - from)), or O(atoms) if some atom was moved
+func (t *CausalTree) atomsInRange(from, to int) ([]Atom, error) {
+	if t.weave.hasMoves() {
+		v := t.flatView()
+		if from < 0 || to < from || to > len(v.order) {
+			return nil, ErrCursorOutOfRange
+		}
+		atoms := make([]Atom, 0, to-from)
+		for i := from; i < to; i++ {
+			atoms = append(atoms, v.atom(i))
+		}
+		return atoms, nil
+	}
+	if from < 0 || to < from || to > t.weave.visibleLen() {
+		return nil, ErrCursorOutOfRange
+	}
+	if from == to {
+		return nil, nil
+	}
+	atoms := make([]Atom, 0, to-from)
+	t.weave.iterate(t.atomIndex(t.weave.findVisible(from).ID), func(leaf *weaveNode, i int) bool {
+		if atom := leaf.atoms[i]; atom.isVisible() {
+			atoms = append(atoms, atom.Atom)
+		}
+		return len(atoms) < to-from
+	})
+	return atoms, nil
+}
+
+// ReplaceRange replaces atoms from the (tree) positions in the range [from, to) with a string,
+// and moves the cursor to its last char.
+//
+// It's undone as a single operation.
+//
+// Time complexity: O((to - from + len(s)) * (log(atoms) + log(sites)))
+func (t *CausalTree) ReplaceRange(from, to int, s string) error {
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	if err := t.DeleteRange(from, to); err != nil {
+		return err
+	}
+	return t.InsertString(s, from-1)
+}
+
+// SetText edits the tree so that it reads as the given text, with the minimal number of
+// insertions and deletions computed by diff.Diff.
+//
+// The tree is read as in ToString, and the edits are applied by walking the weave once. The
+// cursor is kept in place, or moved to its closest visible ancestor if it was deleted. All
+// edits are undone as a single operation.
+//
+// Time complexity: O(atoms*len(text) + (edits) * (log(atoms) + log(sites)))
+func SetText(t *CausalTree, text string) error {
+	v := t.flatView()
+	atoms := v.shownAtoms()
+	ops, err := diff.Diff(atomsToString(atoms), text)
+	if err != nil {
+		return err
+	}
+	// Check that all operations are valid before changing the tree.
+	var i int
+	var cause AtomValue // Nil for the root atom, or an inserted char.
+	for _, op := range ops {
+		switch op.Op {
+		case diff.Keep:
+			cause = v.atoms[v.places[i]].Value
+			i++
+		case diff.Delete:
+			if err := atoms[i].Value.ValidateChild(Delete{}); err != nil {
+				return err
+			}
+			i++
+		case diff.Insert:
+			if cause != nil {
+				if err := cause.ValidateChild(InsertChar{}); err != nil {
+					return err
+				}
+			}
+			cause = nil
+		}
+	}
+	// Apply operations, inserting chars after the last kept or inserted atom.
+	cursor := t.Cursor
+	t.Cursor = AtomID{}
+	t.history.beginGroup()
+	defer t.history.endGroup()
+	i = 0
+	for _, op := range ops {
+		switch op.Op {
+		case diff.Keep:
+			t.Cursor = v.atoms[v.places[i]].ID
+			i++
+		case diff.Delete:
+			prev := t.Cursor
+			t.Cursor = atoms[i].ID
+			if _, err := t.addAtom(Delete{}); err != nil {
+				return err
+			}
+			t.Cursor = prev
+			i++
+		case diff.Insert:
+			if err := t.InsertChar(op.Char); err != nil {
+				return err
+			}
+		}
+	}
+	t.Cursor = cursor
+	t.fixDeletedCursor()
+	return nil
+}
@@ -0,0 +1,173 @@
+package crdt_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBulkTextOperations(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	steps := []struct {
+		f    func() error
+		want string
+	}{
+		{func() error { return tree.InsertString("hello wörld", -1) }, "hello wörld"},
+		{func() error { return tree.InsertString(", dear", 4) }, "hello, dear wörld"},
+		{func() error { return tree.InsertString("", 4) }, "hello, dear wörld"},
+		{func() error { return tree.DeleteRange(5, 11) }, "hello wörld"},
+		{func() error { return tree.DeleteRange(5, 5) }, "hello wörld"},
+		{func() error { return tree.ReplaceRange(6, 11, "there") }, "hello there"},
+		{func() error { return tree.InsertChar('!') }, "hello there!"},
+		// Each operation is undone at once.
+		{func() error { return tree.Undo() }, "hello there"},
+		{func() error { return tree.Undo() }, "hello wörld"},
+		{func() error { return tree.Undo() }, "hello, dear wörld"},
+		{func() error { return tree.Redo() }, "hello wörld"},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if s := tree.ToString(); s != step.want {
+			t.Fatalf("step #%d: got %q, want %q", i, s, step.want)
+		}
+	}
+}
+
+func TestBulkTextOperationsCursor(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertString("abcdef", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.SetCursor(3); err != nil {
+		t.Fatal(err)
+	}
+	c := tree.NewCursor()
+	defer c.Close()
+	steps := []struct {
+		f    func() error
+		want int
+	}{
+		// Cursor at 'd' is moved to 'b' when the range "cde" is deleted.
+		{func() error { return tree.DeleteRange(2, 5) }, 1},
+		// Cursor at 'b' is moved to 'a' when the range "bf" is replaced.
+		{func() error { return tree.ReplaceRange(1, 3, "xyz") }, 0},
+	}
+	for i, step := range steps {
+		if err := step.f(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		got, visible := tree.IndexOf(c.ID())
+		if !visible || got != step.want {
+			t.Fatalf("step #%d: got cursor at %d (visible=%t), want %d", i, got, visible, step.want)
+		}
+	}
+}
+
+func TestBulkTextOperationsErrors(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertString("abc", -1); err != nil {
+		t.Fatalf("InsertString: %v", err)
+	}
+	if err := tree.InsertCounter(); err != nil {
+		t.Fatalf("InsertCounter: %v", err)
+	}
+	if err := tree.InsertAdd(3); err != nil {
+		t.Fatalf("InsertAdd: %v", err)
+	}
+	want := tree.Clone()
+	tests := []struct {
+		desc string
+		f    func() error
+	}{
+		{"insert after end", func() error { return tree.InsertString("x", 5) }},
+		{"insert before beginning", func() error { return tree.InsertString("x", -2) }},
+		{"delete before beginning", func() error { return tree.DeleteRange(-1, 2) }},
+		{"delete after end", func() error { return tree.DeleteRange(2, 6) }},
+		{"delete inverted range", func() error { return tree.DeleteRange(2, 1) }},
+		{"replace after end", func() error { return tree.ReplaceRange(4, 6, "x") }},
+	}
+	for _, test := range tests {
+		if err := test.f(); !errors.Is(err, crdt.ErrCursorOutOfRange) {
+			t.Errorf("%s: got err %v, want %v", test.desc, err, crdt.ErrCursorOutOfRange)
+		}
+	}
+	// Counter contents can't be deleted, nor have chars inserted.
+	if err := tree.DeleteRange(0, 3); err == nil {
+		t.Errorf("DeleteRange(0, 3): got nil err")
+	}
+	if err := tree.InsertString("x", 1); err == nil {
+		t.Errorf("InsertString(x, 1): got nil err")
+	}
+	if diff := cmp.Diff(want, tree, treeOpts); diff != "" {
+		t.Errorf("tree changed after errors (-want, +got):\n%s", diff)
+	}
+}
+
+func TestSetText(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	texts := []string{"", "hello", "hello world", "help, world", "yelp!", "", "über", "dürer"}
+	for _, text := range texts {
+		if err := crdt.SetText(tree, text); err != nil {
+			t.Fatalf("SetText(%q): %v", text, err)
+		}
+		if s := tree.ToString(); s != text {
+			t.Fatalf("SetText(%q): got %q", text, s)
+		}
+	}
+	// Each call is undone at once.
+	for i := len(texts) - 2; i >= 1; i-- {
+		if err := tree.Undo(); err != nil {
+			t.Fatalf("Undo: %v", err)
+		}
+		if s := tree.ToString(); s != texts[i] {
+			t.Fatalf("Undo: got %q, want %q", s, texts[i])
+		}
+	}
+}
+
+func TestSetTextConcurrent(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if err := crdt.SetText(t0, "the cat sat"); err != nil {
+		t.Fatalf("SetText: %v", err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	if err := crdt.SetText(t0, "the black cat sat"); err != nil {
+		t.Fatalf("SetText: %v", err)
+	}
+	if err := crdt.SetText(t1, "the cat sat down"); err != nil {
+		t.Fatalf("SetText: %v", err)
+	}
+	if err := t0.Merge(t1); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if s := t0.ToString(); s != "the black cat sat down" {
+		t.Errorf("got %q, want %q", s, "the black cat sat down")
+	}
+}
+
+func TestSetTextError(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertCounter(); err != nil {
+		t.Fatalf("InsertCounter: %v", err)
+	}
+	if err := tree.InsertAdd(1); err != nil {
+		t.Fatalf("InsertAdd: %v", err)
+	}
+	want := tree.Clone()
+	// Can't delete an InsertAdd, nor insert a char after it.
+	for _, text := range []string{"$", "$0x"} {
+		if err := crdt.SetText(tree, text); err == nil {
+			t.Errorf("SetText(%q): got nil err", text)
+		}
+	}
+	if diff := cmp.Diff(want, tree, treeOpts); diff != "" {
+		t.Errorf("tree changed after errors (-want, +got):\n%s", diff)
+	}
+}
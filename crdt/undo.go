@@ -0,0 +1,331 @@
+package crdt
+
+import (
+	"errors"
+)
+
+// +-----------+
+// | Undo/Redo |
+// +-----------+
+
+// Errors returned by Undo and Redo.
+var (
+	ErrNothingToUndo = errors.New("no operation to undo")
+	ErrNothingToRedo = errors.New("no operation to redo")
+)
+
+// Range of atoms created by an operation, as indices in this site's yarn.
+//
+// Yarn indices don't change when sites are remapped, nor when atoms are compacted.
+type undoGroup struct {
+	start, end uint32
+}
+
+func (g undoGroup) isEmpty() bool {
+	return g.start >= g.end
+}
+
+// Local history of operations made by this site.
+type undoHistory struct {
+	undo, redo []undoGroup
+	// Latest copy of each atom restored by Undo or Redo.
+	copies map[AtomID]AtomID
+	// Whether atoms are being created by Undo or Redo, and shouldn't be recorded as new operations.
+	isReverting bool
+	// Number of nested operations whose atoms are recorded as a single group.
+	depth int
+	// Whether the current group was already pushed into the undo stack.
+	isGroupOpen bool
+}
+
+// Records an atom created by this site as a new operation, and forgets all undone operations.
+func (h *undoHistory) record(index uint32) {
+	if h.isReverting {
+		return
+	}
+	if h.isGroupOpen {
+		h.undo[len(h.undo)-1].end = index + 1
+		return
+	}
+	h.undo = append(h.undo, undoGroup{index, index + 1})
+	h.redo = nil
+	h.isGroupOpen = h.depth > 0
+}
+
+// Starts recording atoms as a single operation, until a matching call to endGroup.
+func (h *undoHistory) beginGroup() {
+	h.depth++
+}
+
+func (h *undoHistory) endGroup() {
+	h.depth--
+	if h.depth == 0 {
+		h.isGroupOpen = false
+	}
+}
+
+// Records that an atom was restored as a copy.
+func (h *undoHistory) setCopy(atomID, copyID AtomID) {
+	if h.copies == nil {
+		h.copies = make(map[AtomID]AtomID)
+	}
+	h.copies[atomID] = copyID
+}
+
+// Returns the latest copy of an atom, or the atom itself if it was never restored.
+func (h undoHistory) latestCopy(atomID AtomID) AtomID {
+	for {
+		copyID, ok := h.copies[atomID]
+		if !ok {
+			return atomID
+		}
+		atomID = copyID
+	}
+}
+
+func (h undoHistory) clone() undoHistory {
+	copies := make(map[AtomID]AtomID, len(h.copies))
+	for atomID, copyID := range h.copies {
+		copies[atomID] = copyID
+	}
+	return undoHistory{
+		undo:   append([]undoGroup(nil), h.undo...),
+		redo:   append([]undoGroup(nil), h.redo...),
+		copies: copies,
+	}
+}
+
+// Remaps the site of all copied atoms.
+//
+// Time complexity: O(copies)
+func (h *undoHistory) remapSite(m indexMap) {
+	if len(h.copies) == 0 {
+		return
+	}
+	copies := make(map[AtomID]AtomID, len(h.copies))
+	for atomID, copyID := range h.copies {
+		copies[atomID.remapSite(m)] = copyID.remapSite(m)
+	}
+	h.copies = copies
+}
+
+// Undo reverts the most recent operation made by this site, by creating new atoms.
+//
+// An inserted atom is reverted with a Delete, and an InsertAdd with another one adding its
+// negation. A Delete is reverted by re-inserting a copy of the deleted char, list element or move
+// right after it. Other deleted atoms, like containers, map keys and set members, are re-inserted
+// as new atoms under (the copy of) their cause, placed first among their siblings, holding a copy
+// of their visible contents. Reverting an atom that was restored this way acts on its latest copy.
+// Since reverting only creates new atoms, the result merges with concurrent remote edits as usual.
+//
+// Operations from other sites are never reverted: an atom isn't restored if another site also
+// deleted it, and atoms that are already hidden or removed by Compact are left alone. If there's
+// nothing left to revert in an operation, it's discarded and the previous one is undone instead.
+//
+// The history is local to this tree, and it's not copied by Fork nor encoded.
+//
+// Time complexity: O((operation atoms) * (log(atoms) + avg. block size))
+func (t *CausalTree) Undo() error {
+	ok, err := t.revertLast(&t.history.undo, &t.history.redo)
+	if err == nil && !ok {
+		return ErrNothingToUndo
+	}
+	return err
+}
+
+// Redo reverts the most recent Undo, if no other operation was made by this site since then.
+//
+// See Undo for how operations are reverted.
+//
+// Time complexity: O((operation atoms) * (log(atoms) + avg. block size))
+func (t *CausalTree) Redo() error {
+	ok, err := t.revertLast(&t.history.redo, &t.history.undo)
+	if err == nil && !ok {
+		return ErrNothingToRedo
+	}
+	return err
+}
+
+// Pops operations from a stack until one is reverted, and pushes the reverting atoms into the other.
+// Returns whether some operation was reverted.
+func (t *CausalTree) revertLast(from, to *[]undoGroup) (bool, error) {
+	for len(*from) > 0 {
+		n := len(*from) - 1
+		group := (*from)[n]
+		*from = (*from)[:n]
+		reverted, err := t.revert(group)
+		if !reverted.isEmpty() {
+			*to = append(*to, reverted)
+		}
+		if err != nil || !reverted.isEmpty() {
+			return !reverted.isEmpty(), err
+		}
+	}
+	return false, nil
+}
+
+// Reverts all atoms within a group, returning the group of atoms created.
+func (t *CausalTree) revert(group undoGroup) (undoGroup, error) {
+	i := siteIndex(t.Sitemap, t.SiteID)
+	atoms := t.Yarns[i][group.start:group.end]
+	start := uint32(len(t.Yarns[i]))
+	t.history.isReverting = true
+	defer func() { t.history.isReverting = false }()
+	for _, atom := range atoms {
+		if err := t.revertAtom(atom); err != nil {
+			return undoGroup{start, uint32(len(t.Yarns[i]))}, err
+		}
+	}
+	return undoGroup{start, uint32(len(t.Yarns[i]))}, nil
+}
+
+// Creates atoms reverting the effect of the given atom, if it's still visible.
+func (t *CausalTree) revertAtom(atom Atom) error {
+	if _, ok := atom.Value.(Delete); ok {
+		return t.restore(atom.Cause, atom.ID.Site)
+	}
+	return t.revertInsert(t.history.latestCopy(atom.ID))
+}
+
+// Deletes an atom, or adds the negation of an InsertAdd, if it's still visible.
+func (t *CausalTree) revertInsert(atomID AtomID) error {
+	leaf, i := t.weave.lookup(atomID)
+	if leaf == nil || !leaf.atoms[i].isLive() {
+		// Atom was already reverted, or removed by Compact.
+		return nil
+	}
+	t.Cursor = atomID
+	if value, ok := leaf.atoms[i].Value.(InsertAdd); ok {
+		return t.InsertAdd(-value.Value)
+	}
+	// Delete the atom itself, even if it's a MoveTo, unlike DeleteChar.
+	if _, err := t.addAtom(Delete{}); err != nil {
+		return err
+	}
+	t.fixDeletedCursor()
+	return nil
+}
+
+// Re-inserts a copy of an atom deleted by the given site, unless it was also deleted by another one.
+func (t *CausalTree) restore(atomID AtomID, site uint16) error {
+	atomID = t.history.latestCopy(atomID)
+	leaf, i := t.weave.lookup(atomID)
+	if leaf == nil || leaf.atoms[i].isLive() || t.isCopyBuried(leaf.atoms[i]) || t.isDeletedByOtherSite(atomID, site) {
+		return nil
+	}
+	switch value := leaf.atoms[i].Value.(type) {
+	case InsertChar:
+		t.Cursor = atomID
+		if err := t.InsertChar(value.Char); err != nil {
+			return err
+		}
+		t.history.setCopy(atomID, t.Cursor)
+		return t.restoreMove(atomID, t.Cursor)
+	case MoveFrom:
+		// Its MoveTo is restored next, so that they remain paired in this site's yarn.
+		t.Cursor = t.history.latestCopy(leaf.atoms[i].Cause)
+		copyID, err := t.addAtom(value)
+		if err != nil {
+			return err
+		}
+		t.Cursor = copyID
+		t.history.setCopy(atomID, copyID)
+	case InsertElem, MoveTo:
+		t.Cursor = atomID
+		copyID, err := t.addAtom(value)
+		if err != nil {
+			return err
+		}
+		t.Cursor = copyID
+		t.history.setCopy(atomID, copyID)
+		if _, ok := value.(InsertElem); ok {
+			return t.restoreMove(atomID, copyID)
+		}
+	case InsertStr, InsertCounter, InsertList, InsertMap, InsertKey, InsertRegister, Set, InsertSet, InsertMember, MarkStart, MarkEnd:
+		return t.restoreContainer(atomID)
+	}
+	return nil
+}
+
+// Returns whether a restored copy of the atom would be buried. Chars, list elements and MoveTo
+// are copied as children of the atom itself, and other atoms under the latest copy of their cause,
+// e.g., the value of a list element that was restored before it.
+//
+// Time complexity: O(1)
+func (t *CausalTree) isCopyBuried(atom weaveAtom) bool {
+	switch atom.Value.(type) {
+	case InsertChar, InsertElem, MoveTo:
+		return atom.isBuried
+	}
+	leaf, i := t.weave.lookup(t.history.latestCopy(atom.Cause))
+	return leaf != nil && leaf.atoms[i].buries(atom.Atom)
+}
+
+// Returns whether a Delete from a site other than the given one has the atom as cause.
+//
+// Time complexity: O(log(atoms) + (number of deletes))
+func (t *CausalTree) isDeletedByOtherSite(atomID AtomID, site uint16) bool {
+	var deletedByOther bool
+	// Delete atoms have the highest priority, so they are the first children.
+	t.weave.walk(t.atomIndex(atomID)+1, func(atom Atom) bool {
+		if _, ok := atom.Value.(Delete); !ok || atom.Cause != atomID {
+			return false
+		}
+		deletedByOther = atom.ID.Site != site
+		return !deletedByOther
+	})
+	return deletedByOther
+}
+
+// Inserts a new container with a copy of the visible contents of a deleted one, under the latest
+// copy of its cause. The cursor is left at the copy of the last atom in the container.
+//
+// Time complexity: O((avg. block size) * (log(atoms) + log(sites)))
+func (t *CausalTree) restoreContainer(atomID AtomID) error {
+	block := t.weave.block(atomID)
+	children := make(map[AtomID][]weaveAtom)
+	for _, atom := range block[1:] {
+		if _, ok := atom.Value.(Delete); !ok {
+			children[atom.Cause] = append(children[atom.Cause], atom)
+		}
+	}
+	copies := make(map[AtomID]AtomID)
+	var copyAtom func(atom weaveAtom, cause AtomID) error
+	copyAtom = func(atom weaveAtom, cause AtomID) error {
+		if atom.isDeleted && atom.ID != atomID {
+			if _, ok := atom.Value.(InsertKey); ok || isContainer(atom.Atom) {
+				// Skip deleted values.
+				return nil
+			}
+			// Descendants are copied under the closest copied ancestor.
+		} else {
+			t.Cursor = cause
+			copyID, err := t.addAtom(atom.Value)
+			if err != nil {
+				return err
+			}
+			copies[atom.ID] = copyID
+			t.history.setCopy(atom.ID, copyID)
+			cause = copyID
+		}
+		// Siblings are sorted from newest to oldest, so they are copied in reverse order to
+		// keep their relative order.
+		siblings := children[atom.ID]
+		for i := len(siblings) - 1; i >= 0; i-- {
+			if err := copyAtom(siblings[i], cause); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := copyAtom(block[0], t.history.latestCopy(block[0].Cause)); err != nil {
+		return err
+	}
+	for i := len(block) - 1; i >= 0; i-- {
+		if copyID, ok := copies[block[i].ID]; ok {
+			t.Cursor = copyID
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package crdt_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/uuid"
+)
+
+func TestUndoRedo(t *testing.T) {
+	trees := testOperations(t, []operation{
+		{op: insertChar, local: 0, char: 'a'},
+		{op: insertChar, local: 0, char: 'b'},
+		{op: insertChar, local: 0, char: 'c'},
+		{op: deleteCharAt, local: 0, pos: 1},
+		{op: check, local: 0, str: "ac"},
+		{op: undo, local: 0},
+		{op: check, local: 0, str: "abc"},
+		{op: undo, local: 0},
+		{op: check, local: 0, str: "ab"},
+		{op: redo, local: 0},
+		{op: check, local: 0, str: "abc"},
+		{op: redo, local: 0},
+		{op: check, local: 0, str: "ac"},
+		{op: undo, local: 0},
+		{op: check, local: 0, str: "abc"},
+		// Cursor is placed at the restored char.
+		{op: insertChar, local: 0, char: 'x'},
+		{op: check, local: 0, str: "abxc"},
+		{op: undo, local: 0},
+		{op: undo, local: 0},
+		{op: check, local: 0, str: "ab"},
+	})
+	tree := trees[0]
+	if err := tree.InsertCharAt('y', -1); err != nil {
+		t.Fatalf("InsertCharAt: %v", err)
+	}
+	// New operations forget undone ones.
+	if err := tree.Redo(); !errors.Is(err, crdt.ErrNothingToRedo) {
+		t.Errorf("Redo: got %v, want %v", err, crdt.ErrNothingToRedo)
+	}
+	// Undoing the insertion of 'b' deletes its restored copy.
+	for i := 0; i < 3; i++ {
+		if err := tree.Undo(); err != nil {
+			t.Fatalf("Undo #%d: %v", i, err)
+		}
+	}
+	if s := tree.ToString(); s != "" {
+		t.Errorf("got %q, want empty string", s)
+	}
+	if err := tree.Undo(); !errors.Is(err, crdt.ErrNothingToUndo) {
+		t.Errorf("Undo: got %v, want %v", err, crdt.ErrNothingToUndo)
+	}
+}
+
+func TestUndoConcurrent(t *testing.T) {
+	teardown := crdt.MockUUIDs(
+		uuid.MustParse("00000001-8891-11ec-a04c-67855c00505b"),
+		uuid.MustParse("00000002-8891-11ec-a04c-67855c00505b"),
+	)
+	defer teardown()
+
+	trees := testOperations(t, []operation{
+		{op: insertChar, local: 0, char: 'a'},
+		{op: insertChar, local: 0, char: 'b'},
+		{op: insertChar, local: 0, char: 'c'},
+		{op: fork, local: 0, remote: 1},
+		// Both sites delete 'a' concurrently.
+		{op: insertCharAt, local: 1, char: 'x', pos: 1},
+		{op: deleteCharAt, local: 1, pos: 0},
+		{op: deleteCharAt, local: 0, pos: 0},
+		{op: merge, local: 0, remote: 1},
+		{op: merge, local: 1, remote: 0},
+		{op: check, local: 0, str: "bxc"},
+		{op: check, local: 1, str: "bxc"},
+		// Site #0 doesn't restore 'a', since it was also deleted by site #1, and undoes
+		// the insertion of 'c' instead.
+		{op: undo, local: 0},
+		{op: check, local: 0, str: "bx"},
+		// Site #1 never undoes site #0's insertions, and undoes the insertion of 'x'.
+		{op: undo, local: 1},
+		{op: check, local: 1, str: "bc"},
+		{op: merge, local: 0, remote: 1},
+		{op: merge, local: 1, remote: 0},
+		{op: check, local: 0, str: "b"},
+		{op: check, local: 1, str: "b"},
+		{op: redo, local: 1},
+		{op: merge, local: 0, remote: 1},
+		{op: check, local: 0, str: "bx"},
+	})
+	if err := trees[1].Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if err := trees[1].Undo(); !errors.Is(err, crdt.ErrNothingToUndo) {
+		t.Errorf("Undo: got %v, want %v", err, crdt.ErrNothingToUndo)
+	}
+}
+
+func TestUndoContainers(t *testing.T) {
+	testOperations(t, []operation{
+		{op: insertStr, local: 0},
+		{op: insertChar, local: 0, char: 'a'},
+		{op: insertChar, local: 0, char: 'b'},
+		{op: insertChar, local: 0, char: 'c'},
+		{op: deleteCharAt, local: 0, pos: 2},
+		{op: insertCounter, local: 0},
+		{op: insertAdd, local: 0, val: 5},
+		{op: insertAdd, local: 0, val: 3},
+		{op: checkJSON, local: 0, str: `[8, "ac"]`},
+		{op: undo, local: 0},
+		{op: checkJSON, local: 0, str: `[5, "ac"]`},
+		// Delete str container.
+		{op: deleteCharAt, local: 0, pos: 4},
+		{op: checkJSON, local: 0, str: `[5]`},
+		// Container is restored with its visible contents, before the other containers.
+		{op: undo, local: 0},
+		{op: checkJSON, local: 0, str: `["ac", 5]`},
+		{op: redo, local: 0},
+		{op: checkJSON, local: 0, str: `[5]`},
+		{op: undo, local: 0},
+		{op: checkJSON, local: 0, str: `["ac", 5]`},
+		{op: undo, local: 0},
+		{op: checkJSON, local: 0, str: `["ac", 0]`},
+	})
+}
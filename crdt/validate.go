@@ -0,0 +1,177 @@
+package crdt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// +------------+
+// | Validation |
+// +------------+
+
+// Errors returned by Validate.
+var (
+	ErrInvalidTree = errors.New("invalid causal tree")
+)
+
+// Validate checks the tree's structural invariants, returning an error wrapping ErrInvalidTree
+// that describes the first violation found. The invariants are:
+//
+//   - the sitemap is sorted, has one yarn per site, and contains this tree's site;
+//   - each yarn contains its site's atoms in order, with increasing timestamps;
+//   - the weave contains the same atoms as the yarns, except for the ones removed by Compact, and
+//     the Weave field mirrors it;
+//   - atoms come after their causes in the weave, and have larger timestamps than them;
+//   - causal blocks are contiguous, and siblings are sorted by priority and ID, descending, except
+//     for children of the root, which are inserted newest first regardless of priority;
+//   - each atom's value is accepted by its cause's ValidateChild;
+//   - atoms are marked as deleted and buried according to their Delete children and causes;
+//   - the tree's timestamp is not behind any atom;
+//   - the cursors refer to atoms in the weave.
+//
+// Time complexity: O(atoms + sites)
+func (t *CausalTree) Validate() error {
+	if err := t.validateYarns(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTree, err)
+	}
+	if err := t.validateWeave(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTree, err)
+	}
+	return nil
+}
+
+// Checks the sitemap and yarns.
+//
+// Time complexity: O(atoms + sites)
+func (t *CausalTree) validateYarns() error {
+	if len(t.Yarns) != len(t.Sitemap) {
+		return fmt.Errorf("%d yarns for %d sites", len(t.Yarns), len(t.Sitemap))
+	}
+	for i := 1; i < len(t.Sitemap); i++ {
+		if bytes.Compare(t.Sitemap[i-1][:], t.Sitemap[i][:]) >= 0 {
+			return fmt.Errorf("sitemap is not sorted at index %d", i)
+		}
+	}
+	if _, ok := t.localSite(t.SiteID); !ok {
+		return fmt.Errorf("site %v is not in sitemap", t.SiteID)
+	}
+	if t.horizon != nil && len(t.horizon) != len(t.Sitemap) {
+		return fmt.Errorf("horizon has %d sites, sitemap has %d", len(t.horizon), len(t.Sitemap))
+	}
+	for i, yarn := range t.Yarns {
+		var prev uint32
+		for j, atom := range yarn {
+			id := atom.ID
+			if int(id.Site) != i || int(id.Index) != j {
+				return fmt.Errorf("atom %v at position %d of yarn %d", id, j, i)
+			}
+			if id.Timestamp <= prev {
+				return fmt.Errorf("atom %v doesn't have a larger timestamp than its predecessor in yarn", id)
+			}
+			if id.Timestamp > t.Timestamp {
+				return fmt.Errorf("atom %v is ahead of tree's timestamp %d", id, t.Timestamp)
+			}
+			if int(atom.Cause.Site) >= len(t.Yarns) {
+				return fmt.Errorf("atom %v has cause %v in unknown site", id, atom.Cause)
+			}
+			prev = id.Timestamp
+		}
+	}
+	return nil
+}
+
+// Checks the weave against the yarns, walking it in a depth-first order with a stack of ancestors.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) validateWeave() error {
+	atoms := t.weave.weaveAtoms()
+	if len(t.Weave) != len(atoms) {
+		return fmt.Errorf("field Weave has %d atoms, weave has %d", len(t.Weave), len(atoms))
+	}
+	for i, atom := range atoms {
+		if t.Weave[i] != atom.Atom {
+			return fmt.Errorf("field Weave has atom %v at position %d, weave has %v", t.Weave[i], i, atom.Atom)
+		}
+	}
+	hasDelete := make(map[AtomID]bool)
+	for _, atom := range atoms {
+		if _, ok := atom.Value.(Delete); ok {
+			hasDelete[atom.Cause] = true
+		}
+	}
+	// Ancestors of the current atom, as weave indices, together with their latest child.
+	// The root atom has index -1.
+	type ancestor struct {
+		i, lastChild int
+	}
+	stack := []ancestor{{-1, -1}}
+	positions := make(map[AtomID]int, len(atoms))
+	for i, atom := range atoms {
+		id := atom.ID
+		if int(id.Site) >= len(t.Yarns) || int(id.Index) >= len(t.Yarns[id.Site]) || t.Yarns[id.Site][id.Index] != atom.Atom {
+			return fmt.Errorf("weave atom %v doesn't match yarns", atom.Atom)
+		}
+		if _, ok := positions[id]; ok {
+			return fmt.Errorf("weave contains atom %v twice", id)
+		}
+		if isCompacted(atom.Atom) {
+			return fmt.Errorf("weave contains compacted atom %v", id)
+		}
+		positions[id] = i
+		if id.Timestamp <= atom.Cause.Timestamp {
+			return fmt.Errorf("atom %v doesn't have a larger timestamp than its cause %v", id, atom.Cause)
+		}
+		// Pop ancestors until finding the cause, whose causal block must contain this atom.
+		for len(stack) > 1 && atoms[stack[len(stack)-1].i].ID != atom.Cause {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 1 && atom.Cause.Timestamp > 0 {
+			if _, ok := positions[atom.Cause]; ok {
+				return fmt.Errorf("atom %v is outside the causal block of its cause %v", id, atom.Cause)
+			}
+			return fmt.Errorf("atom %v doesn't come after its cause %v", id, atom.Cause)
+		}
+		parent := &stack[len(stack)-1]
+		if parent.i >= 0 && parent.lastChild >= 0 && atoms[parent.lastChild].Compare(atom.Atom) <= 0 {
+			return fmt.Errorf("atom %v is not sorted after its sibling %v", id, atoms[parent.lastChild].ID)
+		}
+		var isBuried bool
+		if parent.i >= 0 {
+			cause := atoms[parent.i]
+			if err := cause.Value.ValidateChild(atom.Value); err != nil {
+				return fmt.Errorf("atom %v: %v", id, err)
+			}
+			isBuried = cause.buries(atom.Atom)
+		}
+		if isDeleted := hasDelete[id] || isTombstone(atom.Atom); atom.isDeleted != isDeleted {
+			return fmt.Errorf("atom %v has deleted state %t, want %t", id, atom.isDeleted, isDeleted)
+		}
+		if atom.isBuried != isBuried {
+			return fmt.Errorf("atom %v has buried state %t, want %t", id, atom.isBuried, isBuried)
+		}
+		parent.lastChild = i
+		stack = append(stack, ancestor{i, -1})
+	}
+	var numAtoms int
+	for _, yarn := range t.Yarns {
+		for _, atom := range yarn {
+			if !isCompacted(atom) {
+				numAtoms++
+			}
+		}
+	}
+	if len(atoms) != numAtoms {
+		return fmt.Errorf("weave has %d atoms, yarns have %d", len(atoms), numAtoms)
+	}
+	cursors := []AtomID{t.Cursor}
+	for _, c := range t.cursors {
+		cursors = append(cursors, c.atomID)
+	}
+	for _, cursor := range cursors {
+		if _, ok := positions[cursor]; !ok && cursor != (AtomID{}) {
+			return fmt.Errorf("cursor %v is not in weave", cursor)
+		}
+	}
+	return nil
+}
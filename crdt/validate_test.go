@@ -0,0 +1,114 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+)
+
+func TestValidate(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if err := t0.InsertString("abcd", -1); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []func() error{
+		func() error { return t0.DeleteCharAt(1) },
+		func() error { return t1.InsertCharAt('x', 0) },
+		func() error { return t1.DeleteCharAt(3) },
+		func() error { return t0.Merge(t1) },
+		func() error { return t0.Undo() },
+		func() error { return t0.Compact(t0.Now()) },
+		func() error { return t0.InsertCharAt('y', -1) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+		if err := t0.Validate(); err != nil {
+			t.Fatalf("step #%d: %v", i, err)
+		}
+	}
+}
+
+func TestValidateList(t *testing.T) {
+	tree, l := setupStringList(t, "a", "b", "c")
+	if err := l.Move(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	c := l.Cursor()
+	if err := c.Index(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	// Weave: a, y, b, c, where a -> b -> c is a chain and y is a later child of a.
+	tree := crdt.NewCausalTree()
+	if err := tree.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.InsertCharAt('y', 0); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		desc    string
+		corrupt func(tree *crdt.CausalTree)
+	}{
+		{"atom before its cause", func(tree *crdt.CausalTree) {
+			w := tree.Weave
+			w[2], w[3] = w[3], w[2]
+			tree.SetWeave(w)
+		}},
+		{"unsorted siblings", func(tree *crdt.CausalTree) {
+			w := tree.Weave
+			w[1], w[2], w[3] = w[2], w[3], w[1]
+			tree.SetWeave(w)
+		}},
+		{"timestamp behind atoms", func(tree *crdt.CausalTree) {
+			tree.Timestamp = 1
+		}},
+		{"invalid child", func(tree *crdt.CausalTree) {
+			w := tree.Weave
+			id := w[3].ID
+			w[3].Value = crdt.InsertAdd{1}
+			tree.Yarns[id.Site][id.Index].Value = crdt.InsertAdd{1}
+			tree.SetWeave(w)
+		}},
+	}
+	for _, test := range tests {
+		corrupted := tree.Clone()
+		test.corrupt(corrupted)
+		if err := corrupted.Validate(); !errors.Is(err, crdt.ErrInvalidTree) {
+			t.Errorf("%s: got err %v, want %v", test.desc, err, crdt.ErrInvalidTree)
+		}
+		// Corrupt trees are rejected when decoded.
+		data, err := json.Marshal(corrupted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, new(crdt.CausalTree)); !errors.Is(err, crdt.ErrInvalidEncoding) {
+			t.Errorf("%s: json.Unmarshal: got err %v, want %v", test.desc, err, crdt.ErrInvalidEncoding)
+		}
+		if data, err = corrupted.MarshalBinary(); err != nil {
+			t.Fatal(err)
+		}
+		if err := new(crdt.CausalTree).UnmarshalBinary(data); !errors.Is(err, crdt.ErrInvalidEncoding) {
+			t.Errorf("%s: UnmarshalBinary: got err %v, want %v", test.desc, err, crdt.ErrInvalidEncoding)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Errorf("original tree: %v", err)
+	}
+}
@@ -0,0 +1,631 @@
+package crdt
+
+// +---------------+
+// | Weave storage |
+// +---------------+
+
+/*
+The weave is stored as a B+tree of atom chunks, a.k.a. a rope, instead of a flat array. This allows
+inserting an atom, finding an atom's position by its ID, and finding the i-th visible atom in
+logarithmic time, while still iterating over atoms in weave order with good memory locality.
+
+Each node counts how many atoms are below it, how many of them are visible, that is, not removed
+by filterDeleted, and how many of them are MoveTo atoms. Each leaf stores a chunk of atoms, together with their visibility state, and a
+pointer to the next leaf.
+
+  # BEGIN ASCII ART
+
+                      .---------------.
+                      | size: 9       |
+                      | visible: 7    |
+                      '---------------'
+                       /             \
+         .---------------.         .---------------.
+         | size: 5       |         | size: 4       |
+         | visible: 3    |         | visible: 4    |
+         '---------------'         '---------------'
+         /        \                        |
+   .-------.   .-------.               .---------.
+   | T H I | ->| S ⌫   | ------------> | _ I S _ |
+   '-------'   '-------'               '---------'
+
+  # END ASCII ART
+  # ALT TEXT: A tree with a root node, two inner nodes, and three leaves. The leaves contain, from left to right,
+              the atoms "THI", "S" followed by a delete atom, and "_IS_". Each leaf points to the next one.
+              Each node stores the number of atoms and visible atoms below it. The deleted "S" and the
+              delete atom are not visible.
+*/
+
+const (
+	// Maximum number of atoms in a leaf.
+	maxLeafAtoms = 64
+	// Maximum number of children of an inner node.
+	maxNodeChildren = 16
+)
+
+// Atom within the weave, together with its visibility state.
+type weaveAtom struct {
+	Atom
+	// Whether the atom is the cause of a Delete atom, or a Tombstone.
+	isDeleted bool
+	// Whether the atom descends from a deleted container, or from the value of a deleted map key
+	// or list element.
+	isBuried bool
+}
+
+// Returns whether the atom is part of the tree's contents, that is, whether it's live and neither a
+// mark nor a move.
+func (a weaveAtom) isVisible() bool {
+	switch a.Value.(type) {
+	case MarkStart, MarkEnd, MoveFrom, MoveTo:
+		return false
+	}
+	return a.isLive()
+}
+
+// Returns whether the atom is in effect, that is, it's not a Delete, and it's neither deleted nor buried.
+func (a weaveAtom) isLive() bool {
+	if _, ok := a.Value.(Delete); ok {
+		return false
+	}
+	return !a.isDeleted && !a.isBuried
+}
+
+// Returns whether the given child of this atom is buried.
+func (a weaveAtom) buries(child Atom) bool {
+	if a.isBuried {
+		return true
+	}
+	if !a.isDeleted {
+		return false
+	}
+	switch a.Value.(type) {
+	case InsertKey:
+		return true
+	case InsertElem, Tombstone:
+		// Following elements and moves are not part of the element's value.
+		return isContainer(child)
+	}
+	return isContainer(a.Atom)
+}
+
+// Returns whether deleting the atom buries some of its children.
+func buriesValue(atom Atom) bool {
+	switch atom.Value.(type) {
+	case InsertKey, InsertElem:
+		return true
+	}
+	return isContainer(atom)
+}
+
+// Node of the weave's B+tree. Leaves store atoms, and inner nodes store children.
+type weaveNode struct {
+	parent   *weaveNode
+	children []*weaveNode
+	atoms    []weaveAtom
+	// Next leaf in weave order. Only set for leaves.
+	next *weaveNode
+	// Number of atoms, and of visible atoms, within this node.
+	size, visible int
+	// Number of MoveTo atoms within this node.
+	moves int
+}
+
+func (n *weaveNode) isLeaf() bool {
+	return n.children == nil
+}
+
+// Recomputes the node's counters from its atoms or children.
+//
+// Time complexity: O(max(maxLeafAtoms, maxNodeChildren))
+func (n *weaveNode) update() {
+	n.size, n.visible, n.moves = 0, 0, 0
+	if n.isLeaf() {
+		n.size = len(n.atoms)
+		for _, atom := range n.atoms {
+			if atom.isVisible() {
+				n.visible++
+			}
+			if _, ok := atom.Value.(MoveTo); ok {
+				n.moves++
+			}
+		}
+		return
+	}
+	for _, child := range n.children {
+		n.size += child.size
+		n.visible += child.visible
+		n.moves += child.moves
+	}
+}
+
+// weave is the sequence of atoms of a causal tree.
+type weave struct {
+	root *weaveNode
+	// Leaf containing each atom, indexed like yarns.
+	leaves [][]*weaveNode
+}
+
+// Creates a weave from its flat representation, computing the visibility state of each atom.
+//
+// Time complexity: O(atoms)
+func newWeave(atoms []Atom) *weave {
+	weaveAtoms := make([]weaveAtom, len(atoms))
+	var positions atomPositions
+	for i, atom := range atoms {
+		weaveAtoms[i].Atom = atom
+		weaveAtoms[i].isDeleted = isTombstone(atom)
+		positions.set(atom.ID, i)
+	}
+	for _, atom := range atoms {
+		if _, ok := atom.Value.(Delete); !ok {
+			continue
+		}
+		if j := positions.get(atom.Cause); j >= 0 {
+			weaveAtoms[j].isDeleted = true
+		}
+	}
+	// Causes are always to the left of their effects, so their state is already computed.
+	for i, atom := range atoms {
+		if j := positions.get(atom.Cause); j >= 0 {
+			weaveAtoms[i].isBuried = weaveAtoms[j].buries(atom)
+		}
+	}
+	return buildWeave(weaveAtoms)
+}
+
+// Position of atoms within a flat weave, indexed like yarns.
+type atomPositions [][]int
+
+func (p *atomPositions) set(id AtomID, i int) {
+	site, index := int(id.Site), int(id.Index)
+	for len(*p) <= site {
+		*p = append(*p, nil)
+	}
+	for len((*p)[site]) <= index {
+		(*p)[site] = append((*p)[site], -1)
+	}
+	(*p)[site][index] = i
+}
+
+// Returns the atom's position, or -1 if it's not present.
+func (p atomPositions) get(id AtomID) int {
+	site, index := int(id.Site), int(id.Index)
+	if id.Timestamp == 0 || site >= len(p) || index >= len(p[site]) {
+		return -1
+	}
+	return p[site][index]
+}
+
+// Creates a balanced weave from the list of atoms, leaving room for inserts in every node.
+//
+// Time complexity: O(atoms)
+func buildWeave(atoms []weaveAtom) *weave {
+	w := new(weave)
+	var nodes []*weaveNode
+	var prev *weaveNode
+	for i := 0; i < len(atoms); i += maxLeafAtoms / 2 {
+		end := i + maxLeafAtoms/2
+		if end > len(atoms) {
+			end = len(atoms)
+		}
+		leaf := &weaveNode{atoms: make([]weaveAtom, end-i, maxLeafAtoms+1)}
+		copy(leaf.atoms, atoms[i:end])
+		leaf.update()
+		for _, atom := range leaf.atoms {
+			w.setLeaf(atom.ID, leaf)
+		}
+		if prev != nil {
+			prev.next = leaf
+		}
+		prev = leaf
+		nodes = append(nodes, leaf)
+	}
+	if len(nodes) == 0 {
+		nodes = append(nodes, &weaveNode{})
+	}
+	for len(nodes) > 1 {
+		var parents []*weaveNode
+		for i := 0; i < len(nodes); i += maxNodeChildren / 2 {
+			end := i + maxNodeChildren/2
+			if end > len(nodes) {
+				end = len(nodes)
+			}
+			parent := &weaveNode{children: make([]*weaveNode, end-i, maxNodeChildren+1)}
+			copy(parent.children, nodes[i:end])
+			for _, child := range parent.children {
+				child.parent = parent
+			}
+			parent.update()
+			parents = append(parents, parent)
+		}
+		nodes = parents
+	}
+	w.root = nodes[0]
+	return w
+}
+
+// Returns a deep copy of the weave.
+//
+// Time complexity: O(atoms)
+func (w *weave) clone() *weave {
+	return buildWeave(w.weaveAtoms())
+}
+
+// Returns the flat list of atoms, together with their visibility state.
+//
+// Time complexity: O(atoms)
+func (w *weave) weaveAtoms() []weaveAtom {
+	atoms := make([]weaveAtom, 0, w.len())
+	for leaf, _ := w.find(0); leaf != nil; leaf = leaf.next {
+		atoms = append(atoms, leaf.atoms...)
+	}
+	return atoms
+}
+
+// Returns the number of atoms in weave.
+func (w *weave) len() int {
+	return w.root.size
+}
+
+// Returns the number of visible atoms in weave.
+func (w *weave) visibleLen() int {
+	return w.root.visible
+}
+
+// Returns whether the weave contains MoveTo atoms, so that some items may be shown out of weave order.
+func (w *weave) hasMoves() bool {
+	return w.root.moves > 0
+}
+
+// Returns the flat list of atoms.
+//
+// Time complexity: O(atoms)
+func (w *weave) atoms() []Atom {
+	atoms := make([]Atom, 0, w.len())
+	w.walk(0, func(atom Atom) bool {
+		atoms = append(atoms, atom)
+		return true
+	})
+	return atoms
+}
+
+// Returns the flat list of visible atoms.
+//
+// Time complexity: O(atoms)
+func (w *weave) visibleAtoms() []Atom {
+	atoms := make([]Atom, 0, w.visibleLen())
+	w.iterate(0, func(leaf *weaveNode, i int) bool {
+		if atom := leaf.atoms[i]; atom.isVisible() {
+			atoms = append(atoms, atom.Atom)
+		}
+		return true
+	})
+	return atoms
+}
+
+// Stores the leaf containing an atom.
+//
+// Time complexity: O(1), amortized
+func (w *weave) setLeaf(id AtomID, leaf *weaveNode) {
+	site, index := int(id.Site), int(id.Index)
+	for len(w.leaves) <= site {
+		w.leaves = append(w.leaves, nil)
+	}
+	for len(w.leaves[site]) <= index {
+		w.leaves[site] = append(w.leaves[site], nil)
+	}
+	w.leaves[site][index] = leaf
+}
+
+// Returns the leaf containing an atom, and its index within the leaf. Returns a nil leaf if
+// the atom is not present.
+//
+// Time complexity: O(maxLeafAtoms)
+func (w *weave) lookup(id AtomID) (*weaveNode, int) {
+	site, index := int(id.Site), int(id.Index)
+	if site >= len(w.leaves) || index >= len(w.leaves[site]) || w.leaves[site][index] == nil {
+		return nil, 0
+	}
+	leaf := w.leaves[site][index]
+	for i, atom := range leaf.atoms {
+		if atom.ID == id {
+			return leaf, i
+		}
+	}
+	return nil, 0
+}
+
+// Returns the position of an atom within the weave, or -1 if it's not present.
+//
+// Time complexity: O(log(atoms))
+func (w *weave) indexOf(id AtomID) int {
+	leaf, i := w.lookup(id)
+	if leaf == nil {
+		return -1
+	}
+	for n := leaf; n.parent != nil; n = n.parent {
+		for _, sibling := range n.parent.children {
+			if sibling == n {
+				break
+			}
+			i += sibling.size
+		}
+	}
+	return i
+}
+
+// Returns the number of visible atoms before the i-th atom of a leaf.
+//
+// Time complexity: O(log(atoms))
+func (w *weave) visibleBefore(leaf *weaveNode, i int) int {
+	var count int
+	for _, atom := range leaf.atoms[:i] {
+		if atom.isVisible() {
+			count++
+		}
+	}
+	for n := leaf; n.parent != nil; n = n.parent {
+		for _, sibling := range n.parent.children {
+			if sibling == n {
+				break
+			}
+			count += sibling.visible
+		}
+	}
+	return count
+}
+
+// Returns the atoms in the causal block headed by the given atom, or all atoms for the root atom.
+// Returns nil if the atom is not present.
+//
+// Time complexity: O(log(atoms) + block size)
+func (w *weave) block(id AtomID) []weaveAtom {
+	if id.Timestamp == 0 {
+		return w.weaveAtoms()
+	}
+	i := w.indexOf(id)
+	if i < 0 {
+		return nil
+	}
+	var atoms []weaveAtom
+	w.iterate(i, func(leaf *weaveNode, j int) bool {
+		atom := leaf.atoms[j]
+		if len(atoms) > 0 && atom.Cause.Timestamp < id.Timestamp {
+			return false
+		}
+		atoms = append(atoms, atom)
+		return true
+	})
+	return atoms
+}
+
+// Returns the size of the causal block headed by the i-th atom.
+//
+// Time complexity: O(block size)
+func weaveBlockSize(atoms []weaveAtom, i int) int {
+	j := i + 1
+	for j < len(atoms) && atoms[j].Cause.Timestamp >= atoms[i].ID.Timestamp {
+		j++
+	}
+	return j - i
+}
+
+// Returns the leaf containing the i-th atom, and its index within the leaf.
+// If i is the weave length, returns the last leaf and its length.
+//
+// Time complexity: O(log(atoms))
+func (w *weave) find(i int) (*weaveNode, int) {
+	n := w.root
+	for !n.isLeaf() {
+		last := len(n.children) - 1
+		for j, child := range n.children {
+			if i < child.size || j == last {
+				n = child
+				break
+			}
+			i -= child.size
+		}
+	}
+	return n, i
+}
+
+// Returns the i-th visible atom. It must be smaller than the number of visible atoms.
+//
+// Time complexity: O(log(atoms))
+func (w *weave) findVisible(i int) Atom {
+	n := w.root
+	for !n.isLeaf() {
+		for _, child := range n.children {
+			if i < child.visible {
+				n = child
+				break
+			}
+			i -= child.visible
+		}
+	}
+	for _, atom := range n.atoms {
+		if !atom.isVisible() {
+			continue
+		}
+		if i == 0 {
+			return atom.Atom
+		}
+		i--
+	}
+	panic("visible atom index out of range")
+}
+
+// Returns the i-th atom.
+//
+// Time complexity: O(log(atoms))
+func (w *weave) get(i int) Atom {
+	leaf, j := w.find(i)
+	return leaf.atoms[j].Atom
+}
+
+// Invokes the closure f with the leaf and index of each atom, starting from the i-th atom.
+//
+// The closure should return 'false' to cut the traversal short, as in a 'break' statement. Otherwise, return true.
+//
+// Time complexity: O(log(atoms) + visited atoms)
+func (w *weave) iterate(i int, f func(leaf *weaveNode, i int) bool) {
+	leaf, j := w.find(i)
+	for ; leaf != nil; leaf, j = leaf.next, 0 {
+		for ; j < len(leaf.atoms); j++ {
+			if !f(leaf, j) {
+				return
+			}
+		}
+	}
+}
+
+// Invokes the closure f with each atom, starting from the i-th atom.
+//
+// The closure should return 'false' to cut the traversal short, as in a 'break' statement. Otherwise, return true.
+//
+// Time complexity: O(log(atoms) + visited atoms)
+func (w *weave) walk(i int, f func(Atom) bool) {
+	w.iterate(i, func(leaf *weaveNode, j int) bool {
+		return f(leaf.atoms[j].Atom)
+	})
+}
+
+// Inserts an atom in the given position, updating the visibility of other atoms if it's a Delete.
+//
+// Time complexity: O(log(atoms)), or O((avg. block size) * log(atoms)) when deleting a container.
+func (w *weave) insert(i int, atom Atom) {
+	newAtom := weaveAtom{Atom: atom}
+	if causeLeaf, j := w.lookup(atom.Cause); causeLeaf != nil {
+		newAtom.isBuried = causeLeaf.atoms[j].buries(atom)
+	}
+	leaf, j := w.find(i)
+	leaf.atoms = append(leaf.atoms, weaveAtom{})
+	copy(leaf.atoms[j+1:], leaf.atoms[j:])
+	leaf.atoms[j] = newAtom
+	w.setLeaf(atom.ID, leaf)
+	var visible, moves int
+	if newAtom.isVisible() {
+		visible = 1
+	}
+	if _, ok := atom.Value.(MoveTo); ok {
+		moves = 1
+	}
+	for n := leaf; n != nil; n = n.parent {
+		n.size++
+		n.visible += visible
+		n.moves += moves
+	}
+	if len(leaf.atoms) > maxLeafAtoms {
+		w.split(leaf)
+	}
+	if _, ok := atom.Value.(Delete); ok {
+		w.markDeleted(atom.Cause)
+	}
+}
+
+// Splits an overflowing node in two halves, splitting its ancestors if necessary.
+//
+// Time complexity: O(log(atoms))
+func (w *weave) split(n *weaveNode) {
+	right := new(weaveNode)
+	if n.isLeaf() {
+		half := len(n.atoms) / 2
+		right.atoms = make([]weaveAtom, len(n.atoms)-half, maxLeafAtoms+1)
+		copy(right.atoms, n.atoms[half:])
+		n.atoms = n.atoms[:half]
+		for _, atom := range right.atoms {
+			w.setLeaf(atom.ID, right)
+		}
+		n.next, right.next = right, n.next
+	} else {
+		half := len(n.children) / 2
+		right.children = make([]*weaveNode, len(n.children)-half, maxNodeChildren+1)
+		copy(right.children, n.children[half:])
+		n.children = n.children[:half]
+		for _, child := range right.children {
+			child.parent = right
+		}
+	}
+	n.update()
+	right.update()
+	parent := n.parent
+	if parent == nil {
+		// Grow tree with a new root.
+		parent = &weaveNode{children: []*weaveNode{n}}
+		n.parent = parent
+		w.root = parent
+	}
+	right.parent = parent
+	for i, child := range parent.children {
+		if child == n {
+			parent.children = append(parent.children, nil)
+			copy(parent.children[i+2:], parent.children[i+1:])
+			parent.children[i+1] = right
+			break
+		}
+	}
+	parent.update()
+	if len(parent.children) > maxNodeChildren {
+		w.split(parent)
+	}
+}
+
+// Updates an atom's state with the closure f, propagating any visibility change to its ancestors.
+//
+// Time complexity: O(log(atoms))
+func (w *weave) setState(leaf *weaveNode, i int, f func(atom *weaveAtom)) {
+	wasVisible := leaf.atoms[i].isVisible()
+	f(&leaf.atoms[i])
+	isVisible := leaf.atoms[i].isVisible()
+	if wasVisible == isVisible {
+		return
+	}
+	delta := 1
+	if wasVisible {
+		delta = -1
+	}
+	for n := leaf; n != nil; n = n.parent {
+		n.visible += delta
+	}
+}
+
+// Marks an atom as deleted. If it's a container, map key or list element, its value is buried.
+//
+// Time complexity: O(log(atoms)), or O((avg. block size) * log(atoms)) when burying a value.
+func (w *weave) markDeleted(id AtomID) {
+	leaf, i := w.lookup(id)
+	if leaf == nil {
+		return
+	}
+	wasDeleted := leaf.atoms[i].isDeleted
+	w.setState(leaf, i, func(atom *weaveAtom) { atom.isDeleted = true })
+	if wasDeleted || leaf.atoms[i].isBuried || !buriesValue(leaf.atoms[i].Atom) {
+		return
+	}
+	// Bury atoms within the causal block whose cause now buries them. Causes are always to the
+	// left of their effects, so their state is already updated.
+	w.iterate(w.indexOf(id)+1, func(leaf *weaveNode, i int) bool {
+		atom := leaf.atoms[i]
+		if atom.Cause.Timestamp < id.Timestamp {
+			return false
+		}
+		if causeLeaf, j := w.lookup(atom.Cause); !atom.isBuried && causeLeaf.atoms[j].buries(atom.Atom) {
+			w.setState(leaf, i, func(atom *weaveAtom) { atom.isBuried = true })
+		}
+		return true
+	})
+}
+
+// Remaps the site of all atoms.
+//
+// Time complexity: O(atoms)
+func (w *weave) remapSite(m indexMap) {
+	w.leaves = nil
+	w.iterate(0, func(leaf *weaveNode, i int) bool {
+		atom := &leaf.atoms[i]
+		atom.Atom = atom.remapSite(m)
+		w.setLeaf(atom.ID, leaf)
+		return true
+	})
+}
@@ -0,0 +1,55 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+)
+
+// Checks that the weave's incremental state matches the one computed from scratch when decoding.
+func TestWeaveRandomEdits(t *testing.T) {
+	r := newRand()
+	tree := crdt.NewCausalTree()
+	for i := 0; i < 5000; i++ {
+		s := []rune(tree.ToString())
+		p := r.Float64()
+		var err error
+		if p < 0.6 || len(s) == 0 {
+			err = tree.InsertCharAt('a'+rune(r.Intn(26)), r.Intn(len(s)+1)-1)
+		} else if p < 0.9 {
+			err = tree.DeleteCharAt(r.Intn(len(s)))
+		} else if p < 0.95 {
+			err = tree.InsertStr()
+		} else if pos := strings.IndexRune(tree.ToString(), '*'); pos >= 0 {
+			// Delete a container, and all of its contents.
+			err = tree.DeleteCharAt(len([]rune(tree.ToString()[:pos])))
+		}
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if i%500 != 0 {
+			continue
+		}
+		bs, err := json.Marshal(tree)
+		if err != nil {
+			t.Fatalf("step %d: json.Marshal: %v", i, err)
+		}
+		decoded := new(crdt.CausalTree)
+		if err := json.Unmarshal(bs, decoded); err != nil {
+			t.Fatalf("step %d: json.Unmarshal: %v", i, err)
+		}
+		want, got := decoded.ToString(), tree.ToString()
+		if got != want {
+			t.Fatalf("step %d: got %q, want %q", i, got, want)
+		}
+		for j := range []rune(want) {
+			tree.SetCursor(j)
+			decoded.SetCursor(j)
+			if tree.Cursor != decoded.Cursor {
+				t.Fatalf("step %d: SetCursor(%d): got %v, want %v", i, j, tree.Cursor, decoded.Cursor)
+			}
+		}
+	}
+}
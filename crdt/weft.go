@@ -0,0 +1,83 @@
+package crdt
+
+import (
+	"github.com/google/uuid"
+)
+
+// +----------------+
+// | Portable wefts |
+// +----------------+
+
+// SiteWeft is a Weft keyed by site UUID instead of sitemap index, so that it remains valid when
+// sites are remapped by Fork or Merge, and may be exchanged between trees. Sites that are not
+// present have timestamp 0.
+type SiteWeft map[uuid.UUID]uint32
+
+// SiteWeft converts a local weft into a portable one.
+//
+// Time complexity: O(sites)
+func (t *CausalTree) SiteWeft(weft Weft) (SiteWeft, error) {
+	if len(weft) != len(t.Sitemap) {
+		return nil, ErrWeftInvalidLength
+	}
+	w := make(SiteWeft)
+	for i, ts := range weft {
+		if ts > 0 {
+			w[t.Sitemap[i]] = ts
+		}
+	}
+	return w, nil
+}
+
+// LocalWeft converts a portable weft into a local one, using this tree's sitemap. Returns
+// ErrUnknownSite if the weft has a non-zero timestamp for a site that is not in the sitemap.
+//
+// Time complexity: O(sites*log(sites))
+func (t *CausalTree) LocalWeft(w SiteWeft) (Weft, error) {
+	weft := make(Weft, len(t.Sitemap))
+	for site, ts := range w {
+		if ts == 0 {
+			continue
+		}
+		i, ok := t.localSite(site)
+		if !ok {
+			return nil, ErrUnknownSite
+		}
+		weft[i] = ts
+	}
+	return weft, nil
+}
+
+// Join returns the weft with the latest timestamp of each site, that is, the earliest version
+// that has seen everything seen by either weft.
+//
+// Time complexity: O(sites)
+func (w SiteWeft) Join(other SiteWeft) SiteWeft {
+	joined := make(SiteWeft, len(w))
+	for site, ts := range w {
+		joined[site] = ts
+	}
+	for site, ts := range other {
+		if ts > joined[site] {
+			joined[site] = ts
+		}
+	}
+	return joined
+}
+
+// Meet returns the weft with the earliest timestamp of each site, that is, the latest version
+// whose contents were seen by both wefts.
+//
+// Time complexity: O(sites)
+func (w SiteWeft) Meet(other SiteWeft) SiteWeft {
+	met := make(SiteWeft)
+	for site, ts := range w {
+		if ts2 := other[site]; ts2 < ts {
+			ts = ts2
+		}
+		if ts > 0 {
+			met[site] = ts
+		}
+	}
+	return met
+}
@@ -0,0 +1,94 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestSiteWeft(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if err := t0.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := t0.SiteWeft(t0.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Portable wefts survive encoding.
+	data, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded crdt.SiteWeft
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	// Add many sites, so that t0's index in the sitemap is likely to change.
+	for i := 0; i < 5; i++ {
+		t1, err := t0.Fork()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := t1.InsertCharAt('x', 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := t0.Merge(t1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	weft, err := t0.LocalWeft(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := t0.ViewAt(weft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := view.ToString(); got != "abc" {
+		t.Errorf("ViewAt(saved).ToString() = %q, want %q", got, "abc")
+	}
+	// Round trip.
+	now, err := t0.SiteWeft(t0.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	weft, err = t0.LocalWeft(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(t0.Now(), weft); diff != "" {
+		t.Errorf("LocalWeft(SiteWeft(Now())) (-want, +got):\n%s", diff)
+	}
+}
+
+func TestSiteWeftErrors(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	if _, err := tree.SiteWeft(crdt.Weft{1, 2}); !errors.Is(err, crdt.ErrWeftInvalidLength) {
+		t.Errorf("SiteWeft: got err %v, want %v", err, crdt.ErrWeftInvalidLength)
+	}
+	w := crdt.SiteWeft{uuid.New(): 3}
+	if _, err := tree.LocalWeft(w); !errors.Is(err, crdt.ErrUnknownSite) {
+		t.Errorf("LocalWeft: got err %v, want %v", err, crdt.ErrUnknownSite)
+	}
+}
+
+func TestSiteWeftJoinMeet(t *testing.T) {
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	w1 := crdt.SiteWeft{a: 3, b: 5}
+	w2 := crdt.SiteWeft{a: 4, c: 2}
+	if diff := cmp.Diff(crdt.SiteWeft{a: 4, b: 5, c: 2}, w1.Join(w2)); diff != "" {
+		t.Errorf("Join (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(crdt.SiteWeft{a: 3}, w1.Meet(w2)); diff != "" {
+		t.Errorf("Meet (-want, +got):\n%s", diff)
+	}
+	// Operations don't modify their arguments.
+	if diff := cmp.Diff(crdt.SiteWeft{a: 3, b: 5}, w1); diff != "" {
+		t.Errorf("w1 (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,182 @@
+package crdt
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// +-------------+
+// | Wire format |
+// +-------------+
+
+// SiteAtomID is an AtomID whose site is identified by its UUID, instead of its index in the
+// sitemap. The root atom has a nil site.
+type SiteAtomID struct {
+	Site      uuid.UUID
+	Index     uint32
+	Timestamp uint32
+}
+
+// WireAtom is an Atom whose IDs refer to sites by UUID, so that it may be exchanged between trees
+// without their sitemaps.
+type WireAtom struct {
+	ID    SiteAtomID
+	Cause SiteAtomID
+	Value AtomValue
+}
+
+// Returns the atom ID with its site's UUID.
+func (t *CausalTree) siteAtomID(id AtomID) SiteAtomID {
+	if id.Timestamp == 0 {
+		return SiteAtomID{}
+	}
+	return SiteAtomID{t.Sitemap[id.Site], id.Index, id.Timestamp}
+}
+
+// Returns the site's index in this tree's sitemap, or false if it's unknown.
+//
+// Time complexity: O(log(sites))
+func (t *CausalTree) localSite(site uuid.UUID) (uint16, bool) {
+	i := siteIndex(t.Sitemap, site)
+	if i >= len(t.Sitemap) || t.Sitemap[i] != site {
+		return 0, false
+	}
+	return uint16(i), true
+}
+
+// Returns the atom ID with its site's index in this tree's sitemap, or false if it's unknown.
+//
+// Time complexity: O(log(sites))
+func (t *CausalTree) localAtomID(id SiteAtomID) (AtomID, bool) {
+	if id.Timestamp == 0 {
+		return AtomID{}, true
+	}
+	i, ok := t.localSite(id.Site)
+	return AtomID{i, id.Index, id.Timestamp}, ok
+}
+
+// WireAtoms converts atoms of this tree into the wire format.
+//
+// Time complexity: O(atoms)
+func (t *CausalTree) WireAtoms(atoms ...Atom) ([]WireAtom, error) {
+	wire := make([]WireAtom, len(atoms))
+	for i, atom := range atoms {
+		if int(atom.ID.Site) >= len(t.Sitemap) || int(atom.Cause.Site) >= len(t.Sitemap) {
+			return nil, ErrUnknownSite
+		}
+		wire[i] = WireAtom{t.siteAtomID(atom.ID), t.siteAtomID(atom.Cause), atom.Value}
+	}
+	return wire, nil
+}
+
+// WireAtomsSince returns the atoms created after the provided weft, in the wire format. Sites that
+// are not in this tree are ignored, so a weft received from another tree may be used to send the
+// atoms it's missing.
+//
+// Time complexity: O(sites*log(atoms) + new atoms)
+func (t *CausalTree) WireAtomsSince(w SiteWeft) ([]WireAtom, error) {
+	weft := make(Weft, len(t.Sitemap))
+	for i, site := range t.Sitemap {
+		weft[i] = w[site]
+	}
+	d, err := t.DeltaSince(weft)
+	if err != nil {
+		return nil, err
+	}
+	var atoms []Atom
+	for _, yarn := range d.Yarns {
+		atoms = append(atoms, yarn...)
+	}
+	return t.WireAtoms(atoms...)
+}
+
+// ImportAtoms integrates atoms in the wire format, adding their sites to the sitemap if they're
+// unknown. As in Integrate, atoms may arrive in any order, and are held as pending until their
+// causes and yarn predecessors arrive.
+//
+// Atoms are checked before adding their sites, so the tree is not modified if an error is
+// returned.
+//
+// Time complexity: O((new atoms) * (log(atoms) + avg. block size) + atoms + sites*log(sites))
+func (t *CausalTree) ImportAtoms(atoms ...WireAtom) error {
+	isKnown := make(map[uuid.UUID]bool)
+	var sites []uuid.UUID
+	for _, atom := range atoms {
+		if atom.ID.Site == uuid.Nil || atom.ID.Timestamp <= atom.Cause.Timestamp {
+			return ErrInvalidAtom
+		}
+		if (atom.Cause.Site == uuid.Nil) != (atom.Cause.Timestamp == 0) {
+			return ErrInvalidAtom
+		}
+		for _, site := range []uuid.UUID{atom.ID.Site, atom.Cause.Site} {
+			if site == uuid.Nil || isKnown[site] {
+				continue
+			}
+			isKnown[site] = true
+			if _, ok := t.localSite(site); !ok {
+				sites = append(sites, site)
+			}
+		}
+	}
+	if len(t.Sitemap)+len(sites)-1 > math.MaxUint16 {
+		return ErrSiteLimitExceeded
+	}
+	// Check atoms before modifying the sitemap, giving new sites provisional indices after the
+	// known ones.
+	newSites := make(map[uuid.UUID]uint16, len(sites))
+	for i, site := range sites {
+		newSites[site] = uint16(len(t.Sitemap) + i)
+	}
+	localAtomID := func(id SiteAtomID) AtomID {
+		if i, ok := newSites[id.Site]; ok {
+			return AtomID{i, id.Index, id.Timestamp}
+		}
+		localID, _ := t.localAtomID(id)
+		return localID
+	}
+	local := make([]Atom, len(atoms))
+	for i, atom := range atoms {
+		local[i] = Atom{localAtomID(atom.ID), localAtomID(atom.Cause), atom.Value}
+	}
+	if err := t.checkIntegrate(local, len(t.Sitemap)+len(sites)); err != nil {
+		return err
+	}
+	if len(sites) > 0 {
+		sort.Slice(sites, func(i, j int) bool {
+			return bytes.Compare(sites[i][:], sites[j][:]) < 0
+		})
+		t.mergeSitemap(sites)
+		// Convert atoms again with the merged sitemap.
+		newSites = nil
+		for i, atom := range atoms {
+			local[i] = Atom{localAtomID(atom.ID), localAtomID(atom.Cause), atom.Value}
+		}
+	}
+	return t.Integrate(local...)
+}
+
+// UnmarshalJSON decodes an atom, selecting the concrete type of its value from its tag.
+func (a *WireAtom) UnmarshalJSON(data []byte) error {
+	var atom struct {
+		ID    SiteAtomID
+		Cause SiteAtomID
+		Value json.RawMessage
+	}
+	if err := json.Unmarshal(data, &atom); err != nil {
+		return err
+	}
+	if string(atom.Value) == "null" {
+		*a = WireAtom{ID: atom.ID, Cause: atom.Cause}
+		return nil
+	}
+	value, err := unmarshalAtomValue(atom.Value)
+	if err != nil {
+		return err
+	}
+	*a = WireAtom{ID: atom.ID, Cause: atom.Cause, Value: value}
+	return nil
+}
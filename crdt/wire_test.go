@@ -0,0 +1,145 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/brunokim/causal-tree/crdt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestWireAtoms(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if err := t0.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := t0.DeleteCharAt(1); err != nil {
+		t.Fatal(err)
+	}
+	atoms, err := t0.WireAtomsSince(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(atoms) != 4 {
+		t.Fatalf("got %d atoms, want 4", len(atoms))
+	}
+	for _, atom := range atoms {
+		if atom.ID.Site != t0.SiteID {
+			t.Errorf("atom %v has site %v, want %v", atom, atom.ID.Site, t0.SiteID)
+		}
+	}
+	data, err := json.Marshal(atoms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []crdt.WireAtom
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(atoms, decoded); diff != "" {
+		t.Errorf("decoded atoms (-want, +got):\n%s", diff)
+	}
+	// Import into an unrelated tree, in reverse order.
+	t1 := crdt.NewCausalTree()
+	for i := len(decoded) - 1; i >= 0; i-- {
+		if err := t1.ImportAtoms(decoded[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := t1.ToString(); got != "ac" {
+		t.Errorf("ToString() = %q, want %q", got, "ac")
+	}
+	if len(t1.Sitemap) != 2 {
+		t.Errorf("got sitemap %v, want 2 sites", t1.Sitemap)
+	}
+}
+
+func TestWireAtomsSync(t *testing.T) {
+	t0 := crdt.NewCausalTree()
+	if err := t0.InsertString("abc", -1); err != nil {
+		t.Fatal(err)
+	}
+	t1, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := t0.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// t0 and t1 never learn about each other's sitemaps, and t2's atoms are relayed by t1.
+	if err := t0.InsertCharAt('x', 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.DeleteCharAt(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := t2.InsertCharAt('y', 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Merge(t2); err != nil {
+		t.Fatal(err)
+	}
+	sync := func(from, to *crdt.CausalTree) {
+		weft, err := to.SiteWeft(to.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		atoms, err := from.WireAtomsSince(weft)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := to.ImportAtoms(atoms...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync(t1, t0)
+	sync(t0, t1)
+	if got0, got1 := t0.ToString(), t1.ToString(); got0 != got1 || got0 != "axby" {
+		t.Errorf("t0 = %q, t1 = %q, want %q", got0, got1, "axby")
+	}
+	if len(t0.Pending()) > 0 {
+		t.Errorf("t0 has pending atoms: %v", t0.Pending())
+	}
+}
+
+func TestImportAtomsErrors(t *testing.T) {
+	tree := crdt.NewCausalTree()
+	site := uuid.New()
+	tests := []crdt.WireAtom{
+		// Atom without site.
+		{ID: crdt.SiteAtomID{Index: 0, Timestamp: 1}, Value: crdt.InsertChar{'a'}},
+		// Atom older than its cause.
+		{
+			ID:    crdt.SiteAtomID{Site: site, Index: 1, Timestamp: 2},
+			Cause: crdt.SiteAtomID{Site: site, Index: 0, Timestamp: 3},
+			Value: crdt.InsertChar{'a'},
+		},
+		// Cause with timestamp but without site.
+		{
+			ID:    crdt.SiteAtomID{Site: site, Index: 1, Timestamp: 4},
+			Cause: crdt.SiteAtomID{Index: 0, Timestamp: 3},
+			Value: crdt.InsertChar{'a'},
+		},
+	}
+	for i, atom := range tests {
+		if err := tree.ImportAtoms(atom); !errors.Is(err, crdt.ErrInvalidAtom) {
+			t.Errorf("#%d: got err %v, want %v", i, err, crdt.ErrInvalidAtom)
+		}
+	}
+	// Atoms rejected by Integrate, as a counter increment is not a valid child of a char.
+	a := crdt.SiteAtomID{Site: site, Index: 0, Timestamp: 2}
+	err := tree.ImportAtoms(
+		crdt.WireAtom{ID: a, Value: crdt.InsertChar{'a'}},
+		crdt.WireAtom{ID: crdt.SiteAtomID{Site: site, Index: 1, Timestamp: 3}, Cause: a, Value: crdt.InsertAdd{1}},
+	)
+	if !errors.Is(err, crdt.ErrInvalidAtom) {
+		t.Errorf("invalid child: got err %v, want %v", err, crdt.ErrInvalidAtom)
+	}
+	// The tree is left unmodified.
+	if len(tree.Sitemap) != 1 {
+		t.Errorf("got sitemap %v, want 1 site", tree.Sitemap)
+	}
+}
@@ -158,7 +158,9 @@ export class Crdt {
     let atomEl = $("<div>")
       .addClass("atom")
       .append($("<div>").addClass("atom-id").text(idString(atom["ID"])))
-      .append($("<div>").addClass("atom-value").text(atom["Value"]))
+      .append(
+        $("<div>").addClass("atom-value").text(valueString(atom["Value"]))
+      )
       .append($("<div>").addClass("atom-cause").text(idString(atom["Cause"])));
     if (idString(atom["ID"]) == idString(cursor)) {
       atomEl.addClass("cursor");
@@ -235,3 +237,56 @@ export class Crdt {
 function idString(id) {
   return `S${id["Site"]}@T${id["Timestamp"]}`;
 }
+
+function scalarString(value) {
+  for (const field of ["Str", "Int", "Bool", "Float"]) {
+    if (field in value) {
+      return JSON.stringify(value[field]);
+    }
+  }
+  return "";
+}
+
+function valueString(value) {
+  if (value === null) {
+    return "compacted";
+  }
+  switch (value["Type"]) {
+    case "InsertChar":
+      return `insert ${value["Char"]}`;
+    case "InsertAdd":
+      return `insert ${value["Value"]}`;
+    case "InsertStr":
+      return "insert str container";
+    case "InsertCounter":
+      return "insert counter container";
+    case "InsertList":
+      return "insert list container";
+    case "InsertElem":
+      return "insert list element";
+    case "InsertMap":
+      return "insert map container";
+    case "InsertKey":
+      return `insert key ${JSON.stringify(value["Key"])}`;
+    case "InsertRegister":
+      return "insert register container";
+    case "Set":
+      return `set ${scalarString(value)}`;
+    case "InsertSet":
+      return "insert set container";
+    case "InsertMember":
+      return `insert member ${scalarString(value)}`;
+    case "MarkStart":
+      return `mark ${value["Name"]}=${scalarString(value) || "null"}`;
+    case "MarkEnd":
+      return "mark end";
+    case "MoveFrom":
+      return "move from";
+    case "MoveTo":
+      return "move to";
+    case "Delete":
+      return "delete";
+    default:
+      return JSON.stringify(value);
+  }
+}
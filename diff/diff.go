@@ -59,15 +59,8 @@ func Diff(s1, s2 string) ([]Operation, error) {
 	if !utf8.ValidString(s2) {
 		return nil, fmt.Errorf("s2 is not a valid utf8 string")
 	}
-	m, n := utf8.RuneCountInString(s1), utf8.RuneCountInString(s2)
-	chars1 := make([]rune, m)
-	for i, ch := range s1 {
-		chars1[i] = ch
-	}
-	chars2 := make([]rune, n)
-	for j, ch := range s2 {
-		chars2[j] = ch
-	}
+	chars1, chars2 := []rune(s1), []rune(s2)
+	m, n := len(chars1), len(chars2)
 	ops := make([]Operation, (m+1)*(n+1))
 	coord := func(i, j int) int {
 		return i*(n+1) + j
@@ -83,6 +83,18 @@ func TestDiff(t *testing.T) {
 				{Op: diff.Insert, Char: 'y'},
 			},
 		},
+		{
+			s1: "über",
+			s2: "dürer",
+			want: []diff.Operation{
+				{Op: diff.Insert, Char: 'd'},
+				{Op: diff.Keep, Char: 'ü'},
+				{Op: diff.Insert, Char: 'r'},
+				{Op: diff.Delete, Char: 'b'},
+				{Op: diff.Keep, Char: 'e'},
+				{Op: diff.Keep, Char: 'r'},
+			},
+		},
 		{
 			s1: "xabdyefg",
 			s2: "E",
@@ -124,6 +136,7 @@ func TestDistance(t *testing.T) {
 		{"abc", "ac", 1},
 		{"abc", "axc", 2},
 		{"abcd", "xabdy", 3},
+		{"über", "dürer", 3},
 	}
 	for _, test := range tests {
 		got, err := diff.Distance(test.s1, test.s2)